@@ -31,6 +31,7 @@ func main() {
 		Commands: []*cli.Command{
 			rootCmd,
 			procfsCmd,
+			serveCmd,
 		},
 	}
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
@@ -39,6 +39,11 @@ var procfsCmd = &cli.Command{
 			Usage: "base path for procfs operations (root, pid=<n>, self, thread-self)",
 			Value: "root",
 		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format for subcommand results (text, json, jsonl)",
+			Value: "text",
+		},
 	},
 	Commands: []*cli.Command{
 		procfsOpenCmd,
@@ -46,6 +51,13 @@ var procfsCmd = &cli.Command{
 	},
 
 	Before: func(ctx context.Context, cmd *cli.Command) (_ context.Context, Err error) {
+		switch mode := cmd.String("output"); mode {
+		case "text", "json", "jsonl":
+			ctx = context.WithValue(ctx, "output", mode)
+		default:
+			return nil, fmt.Errorf("invalid --output value %q", mode)
+		}
+
 		var opts []procfs.OpenOption
 		if cmd.Bool("unmasked") {
 			opts = append(opts, procfs.UnmaskedProcRoot)
@@ -131,13 +143,11 @@ var procfsOpenCmd = cmdWithOptions(&cli.Command{
 			}
 		}
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "procfs-open", Subpath: subpath, Error: toCliError(err)})
 		}
 		defer f.Close()
 
-		fmt.Println("FILE-PATH", f.Name())
-		// TODO: Input/output file data.
-		return nil
+		return emit(ctx, cliResult{Op: "procfs-open", Subpath: subpath, FilePath: f.Name()})
 	},
 }, oflags("oflags", "O_* flags to use when opening the file", unix.O_RDONLY))
 
@@ -177,9 +187,8 @@ var procfsReadlinkCmd = &cli.Command{
 
 		target, err := proc.Readlink(base, subpath)
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "procfs-readlink", Subpath: subpath, Error: toCliError(err)})
 		}
-		fmt.Println("LINK-TARGET", target)
-		return nil
+		return emit(ctx, cliResult{Op: "procfs-readlink", Subpath: subpath, LinkTarget: target})
 	},
 }
@@ -31,6 +31,11 @@ var rootCmd = &cli.Command{
 			Name:     "root",
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: text, json, or jsonl",
+			Value: "text",
+		},
 	},
 	Commands: []*cli.Command{
 		rootResolveCmd,
@@ -46,6 +51,9 @@ var rootCmd = &cli.Command{
 		rootRmdirCmd,
 		rootRmdirAllCmd,
 		rootRenameCmd,
+		rootChecksumCmd,
+		rootWalkCmd,
+		rootExtractTarCmd,
 	},
 
 	Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
@@ -56,6 +64,13 @@ var rootCmd = &cli.Command{
 			return nil, errors.New(`Required flag "root" not set`)
 		}
 
+		switch mode := cmd.String("output"); mode {
+		case "text", "json", "jsonl":
+			ctx = context.WithValue(ctx, "output", mode)
+		default:
+			return nil, fmt.Errorf("invalid --output value %q", mode)
+		}
+
 		root, err := pathrs.OpenRoot(rootPath)
 		if err != nil {
 			return nil, err
@@ -92,36 +107,37 @@ var rootResolveCmd = cmdWithOptions(&cli.Command{
 		root := ctx.Value("root").(*pathrs.Root)
 		follow := cmd.Bool("follow")
 		subpath := cmd.StringArg("subpath")
+		resolveFlags := ctx.Value("resolve").(pathrs.ResolverFlags)
 
-		var (
-			handle *pathrs.Handle
-			err    error
-		)
-		if follow {
-			handle, err = root.Resolve(subpath)
-		} else {
-			handle, err = root.ResolveNoFollow(subpath)
-		}
+		handle, err := root.ResolveWithFlags(subpath, follow, pathrs.WithFlags(resolveFlags))
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "resolve", Subpath: subpath, Error: toCliError(err)})
 		}
 		defer handle.Close()
 
-		fmt.Println("HANDLE-PATH", handle.IntoFile().Name())
+		res := cliResult{Op: "resolve", Subpath: subpath, HandlePath: handle.IntoFile().Name()}
 
 		if val := ctx.Value("reopen"); val != nil {
 			oflags := val.(int)
 			f, err := handle.OpenFile(oflags)
 			if err != nil {
+				return emit(ctx, cliResult{Op: "resolve", Subpath: subpath, Error: toCliError(err)})
+			}
+			defer f.Close()
+
+			res.FilePath = f.Name()
+
+			if err := streamInput(f, cmd.String("input")); err != nil {
+				return err
+			}
+			if err := streamOutput(f, cmd.String("output-file")); err != nil {
 				return err
 			}
-			// TODO: Input/output file data.
-			fmt.Println("FILE-PATH", f.Name())
 		}
 
-		return nil
+		return emit(ctx, res)
 	},
-}, oflags("reopen", "reopen the handle with these O_* flags", nil))
+}, oflags("reopen", "reopen the handle with these O_* flags", nil), resolveFlag("resolve", "RESOLVE_* flags to use when resolving the path"), ioFlags())
 
 var rootOpenCmd = cmdWithOptions(&cli.Command{
 	Name:  "open",
@@ -143,6 +159,7 @@ var rootOpenCmd = cmdWithOptions(&cli.Command{
 		root := ctx.Value("root").(*pathrs.Root)
 		follow := cmd.Bool("follow")
 		subpath := cmd.StringArg("subpath")
+		resolveFlags := ctx.Value("resolve").(pathrs.ResolverFlags)
 
 		oflags := unix.O_RDONLY
 		if val := ctx.Value("oflags"); val != nil {
@@ -156,21 +173,34 @@ var rootOpenCmd = cmdWithOptions(&cli.Command{
 			f   *os.File
 			err error
 		)
-		if oflags == 0 /* O_RDONLY */ {
-			f, err = root.Open(subpath)
+		if resolveFlags == 0 {
+			if oflags == 0 /* O_RDONLY */ {
+				f, err = root.Open(subpath)
+			} else {
+				f, err = root.OpenFile(subpath, oflags)
+			}
 		} else {
-			f, err = root.OpenFile(subpath, oflags)
+			var handle *pathrs.Handle
+			handle, err = root.ResolveWithFlags(subpath, follow, pathrs.WithFlags(resolveFlags))
+			if err == nil {
+				defer handle.Close()
+				f, err = handle.OpenFile(oflags)
+			}
 		}
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "open", Subpath: subpath, Error: toCliError(err)})
 		}
 		defer f.Close()
 
-		// TODO: Input/output file data.
-		fmt.Println("FILE-PATH", f.Name())
-		return nil
+		if err := streamInput(f, cmd.String("input")); err != nil {
+			return err
+		}
+		if err := streamOutput(f, cmd.String("output-file")); err != nil {
+			return err
+		}
+		return emit(ctx, cliResult{Op: "open", Subpath: subpath, FilePath: f.Name()})
 	},
-}, oflags("oflags", "O_* flags to use when opening the file", unix.O_RDONLY))
+}, oflags("oflags", "O_* flags to use when opening the file", unix.O_RDONLY), resolveFlag("resolve", "RESOLVE_* flags to use when resolving the path"), ioFlags())
 
 var rootMkfileCmd = cmdWithOptions(&cli.Command{
 	Name:  "mkfile",
@@ -189,17 +219,23 @@ var rootMkfileCmd = cmdWithOptions(&cli.Command{
 
 		f, err := root.Create(subpath, oflags, mode)
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "mkfile", Subpath: subpath, Error: toCliError(err)})
 		}
 		defer f.Close()
 
-		// TODO: Input/output file data?
-		fmt.Println("FILE-PATH", f.Name())
-		return nil
+		if err := streamInput(f, cmd.String("input")); err != nil {
+			return err
+		}
+		if err := streamOutput(f, cmd.String("output-file")); err != nil {
+			return err
+		}
+		return emit(ctx, cliResult{Op: "mkfile", Subpath: subpath, FilePath: f.Name()})
 	},
 },
 	oflags("oflags", "O_* flags to use when creating the file", unix.O_RDONLY),
-	modeFlag("mode", "file mode for the created file", "0o644"),
+	modeFlag([]string{"mode", "m"}, "PATHRS_MODE", "file mode for the created file", "0o644"),
+	ioFlags(),
+	configFileFlag(),
 )
 
 var rootMkdirCmd = cmdWithOptions(&cli.Command{
@@ -216,10 +252,12 @@ var rootMkdirCmd = cmdWithOptions(&cli.Command{
 		subpath := cmd.StringArg("subpath")
 		mode := ctx.Value("mode").(os.FileMode)
 
-		return root.Mkdir(subpath, mode)
+		err := root.Mkdir(subpath, mode)
+		return emit(ctx, cliResult{Op: "mkdir", Subpath: subpath, Error: toCliError(err)})
 	},
 },
-	modeFlag("mode", "file mode for the created directory", "0o755"),
+	modeFlag([]string{"mode", "m"}, "PATHRS_MODE", "file mode for the created directory", "0o755"),
+	configFileFlag(),
 )
 
 var rootMkdirAllCmd = cmdWithOptions(&cli.Command{
@@ -238,15 +276,15 @@ var rootMkdirAllCmd = cmdWithOptions(&cli.Command{
 
 		handle, err := root.MkdirAll(subpath, mode)
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "mkdir-all", Subpath: subpath, Error: toCliError(err)})
 		}
 		defer handle.Close()
 
-		fmt.Println("HANDLE-PATH", handle.IntoFile().Name())
-		return nil
+		return emit(ctx, cliResult{Op: "mkdir-all", Subpath: subpath, HandlePath: handle.IntoFile().Name()})
 	},
 },
-	modeFlag("mode", "file mode for the created directories", "0o755"),
+	modeFlag([]string{"mode", "m"}, "PATHRS_MODE", "file mode for the created directories", "0o755"),
+	configFileFlag(),
 )
 
 var rootMknodCmd = cmdWithOptions(&cli.Command{
@@ -291,10 +329,12 @@ var rootMknodCmd = cmdWithOptions(&cli.Command{
 		}
 		dev := unix.Mkdev(cmd.Uint32Arg("major"), cmd.Uint32Arg("minor"))
 
-		return root.Mknod(subpath, mode, dev)
+		err := root.Mknod(subpath, mode, dev)
+		return emit(ctx, cliResult{Op: "mknod", Subpath: subpath, Error: toCliError(err)})
 	},
 },
-	modeFlag("mode", "file mode for the created inode", "0o644"),
+	modeFlag([]string{"mode", "m"}, "PATHRS_MODE", "file mode for the created inode", "0o644"),
+	configFileFlag(),
 )
 
 var rootHardlinkCmd = &cli.Command{
@@ -314,7 +354,8 @@ var rootHardlinkCmd = &cli.Command{
 		target := cmd.StringArg("target")
 		linkname := cmd.StringArg("linkname")
 
-		return root.Hardlink(target, linkname)
+		err := root.Hardlink(target, linkname)
+		return emit(ctx, cliResult{Op: "hardlink", Subpath: linkname, Error: toCliError(err)})
 	},
 }
 
@@ -335,7 +376,8 @@ var rootSymlinkCmd = &cli.Command{
 		target := cmd.StringArg("target")
 		linkname := cmd.StringArg("linkname")
 
-		return root.Symlink(target, linkname)
+		err := root.Symlink(target, linkname)
+		return emit(ctx, cliResult{Op: "symlink", Subpath: linkname, Error: toCliError(err)})
 	},
 }
 
@@ -354,10 +396,9 @@ var rootReadlinkCmd = &cli.Command{
 
 		target, err := root.Readlink(subpath)
 		if err != nil {
-			return err
+			return emit(ctx, cliResult{Op: "readlink", Subpath: subpath, Error: toCliError(err)})
 		}
-		fmt.Println("LINK-TARGET", target)
-		return nil
+		return emit(ctx, cliResult{Op: "readlink", Subpath: subpath, LinkTarget: target})
 	},
 }
 
@@ -374,7 +415,8 @@ var rootUnlinkCmd = &cli.Command{
 		root := ctx.Value("root").(*pathrs.Root)
 		subpath := cmd.StringArg("subpath")
 
-		return root.RemoveFile(subpath)
+		err := root.RemoveFile(subpath)
+		return emit(ctx, cliResult{Op: "unlink", Subpath: subpath, Error: toCliError(err)})
 	},
 }
 
@@ -391,7 +433,8 @@ var rootRmdirCmd = &cli.Command{
 		root := ctx.Value("root").(*pathrs.Root)
 		subpath := cmd.StringArg("subpath")
 
-		return root.RemoveDir(subpath)
+		err := root.RemoveDir(subpath)
+		return emit(ctx, cliResult{Op: "rmdir", Subpath: subpath, Error: toCliError(err)})
 	},
 }
 
@@ -408,7 +451,8 @@ var rootRmdirAllCmd = &cli.Command{
 		root := ctx.Value("root").(*pathrs.Root)
 		subpath := cmd.StringArg("subpath")
 
-		return root.RemoveAll(subpath)
+		err := root.RemoveAll(subpath)
+		return emit(ctx, cliResult{Op: "rmdir-all", Subpath: subpath, Error: toCliError(err)})
 	},
 }
 
@@ -451,6 +495,7 @@ var rootRenameCmd = &cli.Command{
 		if cmd.Bool("whiteout") {
 			renameArgs |= unix.RENAME_WHITEOUT
 		}
-		return root.Rename(src, dst, renameArgs)
+		err := root.Rename(src, dst, renameArgs)
+		return emit(ctx, cliResult{Op: "rename", Subpath: dst, Error: toCliError(err)})
 	},
 }
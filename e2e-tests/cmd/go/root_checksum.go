@@ -0,0 +1,343 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/sys/unix"
+
+	"cyphar.com/go-pathrs"
+)
+
+var rootChecksumCmd = &cli.Command{
+	Name:  "checksum",
+	Usage: "compute a reproducible content digest of a subpath inside the root",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "algo",
+			Usage: "digest algorithm to use",
+			Value: "sha256",
+		},
+		&cli.StringFlag{
+			Name:  "follow-symlinks",
+			Usage: "how to treat symlinks encountered during the walk (no, in-root)",
+			Value: "no",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "glob matched (via path.Match, wildcards never match '/') against paths relative to the digested subpath, to exclude from the digest",
+		},
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{
+			Name: "subpath",
+		},
+	},
+
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		root := ctx.Value("root").(*pathrs.Root)
+		subpath := cmd.StringArg("subpath")
+
+		if algo := cmd.String("algo"); algo != "sha256" {
+			return fmt.Errorf("unsupported --algo %q: only sha256 is currently supported", algo)
+		}
+		followSymlinks := cmd.String("follow-symlinks")
+		switch followSymlinks {
+		case "no", "in-root":
+		default:
+			return fmt.Errorf("invalid --follow-symlinks value %q", followSymlinks)
+		}
+
+		c := &checksummer{
+			root:           root,
+			followSymlinks: followSymlinks,
+			excludes:       cmd.StringSlice("exclude"),
+		}
+		sum, err := c.digest(subpath, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("sha256:%s %s\n", hex.EncodeToString(sum), subpath)
+		return nil
+	},
+}
+
+// checksummer computes reproducible content digests of a subpath inside a
+// Root. Every filesystem access is routed through the Root's safe resolver
+// (Root.Resolve) or an already-resolved Handle, so the walk cannot be tricked
+// into reading or hashing anything outside the root, even on a tree that is
+// being concurrently modified by an attacker.
+type checksummer struct {
+	root           *pathrs.Root
+	followSymlinks string
+	excludes       []string
+
+	// ancestors guards against symlink loops when followSymlinks == "in-root"
+	// (e.g. a directory symlink "a -> ."): it tracks the (dev, ino) of every
+	// directory currently on the active recursion stack, not every directory
+	// ever seen, so two sibling paths that happen to resolve to the same
+	// directory (a "diamond", not a cycle) are still both digested.
+	ancestors map[dirKey]struct{}
+}
+
+// dirKey identifies a directory inode for cycle detection, independent of
+// which path was used to reach it.
+type dirKey struct {
+	dev uint64
+	ino uint64
+}
+
+// excluded reports whether relpath (relative to the digested subpath, e.g.
+// "" for the subpath itself or "sub/file" for a descendant) matches one of
+// the --exclude globs. Each glob is matched against the whole relpath with
+// path.Match, whose wildcards never match a '/' -- a pattern such as "*.txt"
+// matches a top-level "file.txt" but not a nested "sub/file.txt" (which
+// "*/*.txt" or "sub/*.txt" would match). Excluding a directory (e.g. "sub")
+// skips its whole subtree, since its children are never visited.
+func (c *checksummer) excluded(relpath string) bool {
+	for _, pattern := range c.excludes {
+		if ok, _ := path.Match(pattern, relpath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// digest computes the content digest of subpath (relative to the Root's
+// directory tree), recursing into directories. relpath is subpath's path
+// relative to the originally digested subpath (used only for matching
+// --exclude globs via [checksummer.excluded]; "" at the top level). The hash
+// combines a canonical metadata header with either the file contents
+// (regular files), the link target (symlinks), or the sorted digests of the
+// directory's children.
+func (c *checksummer) digest(subpath, relpath string) ([]byte, error) {
+	var (
+		handle *pathrs.Handle
+		err    error
+	)
+	if c.followSymlinks == "in-root" {
+		// Resolve fully follows symlinks (including a trailing one), but
+		// never outside the root, so the final component can never escape.
+		handle, err = c.root.Resolve(subpath)
+	} else {
+		handle, err = c.root.ResolveNoFollow(subpath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", subpath, err)
+	}
+	defer handle.Close()
+
+	// O_PATH|O_NOFOLLOW never dereferences the final component, so this is
+	// safe to use as the basis for both the stat() below and any subsequent
+	// xattr lookups, regardless of what kind of inode it refers to.
+	pathFd, err := handle.OpenFile(unix.O_PATH | unix.O_NOFOLLOW)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", subpath, err)
+	}
+	defer pathFd.Close()
+
+	info, err := pathFd.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat %q: %w", subpath, err)
+	}
+
+	h := sha256.New()
+	linktarget, err := c.writeHeader(h, pathFd, info, subpath, relpath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info.IsDir():
+		if c.followSymlinks == "in-root" {
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				key := dirKey{dev: uint64(st.Dev), ino: st.Ino}
+				if c.ancestors == nil {
+					c.ancestors = make(map[dirKey]struct{})
+				}
+				if _, cyclic := c.ancestors[key]; cyclic {
+					return nil, fmt.Errorf("digest %q: symlink cycle detected (directory is its own ancestor)", subpath)
+				}
+				c.ancestors[key] = struct{}{}
+				defer delete(c.ancestors, key)
+			}
+		}
+		if err := c.digestDir(h, handle, subpath, relpath); err != nil {
+			return nil, err
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		io.WriteString(h, linktarget) //nolint:errcheck // hash.Hash.Write never fails
+	case info.Mode().IsRegular():
+		rf, err := handle.OpenFile(unix.O_RDONLY)
+		if err != nil {
+			return nil, fmt.Errorf("open %q for reading: %w", subpath, err)
+		}
+		defer rf.Close()
+		if _, err := io.Copy(h, rf); err != nil {
+			return nil, fmt.Errorf("hash contents of %q: %w", subpath, err)
+		}
+	default:
+		// Other inode types (devices, fifos, sockets) have no content beyond
+		// what's already captured by the header.
+	}
+
+	return h.Sum(nil), nil
+}
+
+// digestDir hashes the sorted digests of a directory's children into h. A
+// sentinel "contents" line is always emitted (even for an empty directory) so
+// that a directory's hash can never collide with hashing just its header.
+// relpath is subpath's path relative to the originally digested subpath (see
+// [checksummer.digest]).
+func (c *checksummer) digestDir(h hash.Hash, dirHandle *pathrs.Handle, subpath, relpath string) error {
+	df, err := dirHandle.OpenFile(unix.O_RDONLY | unix.O_DIRECTORY)
+	if err != nil {
+		return fmt.Errorf("open %q as directory: %w", subpath, err)
+	}
+	defer df.Close()
+
+	// os.File.ReadDir(-1) returns entries in directory order, so sort them
+	// by filename to get the stable order a reproducible digest needs.
+	entries, err := df.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("readdir %q: %w", subpath, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	io.WriteString(h, "dir-contents:\n") //nolint:errcheck // hash.Hash.Write never fails
+	for _, entry := range entries {
+		childRelpath := path.Join(relpath, entry.Name())
+		if c.excluded(childRelpath) {
+			continue
+		}
+		childPath := path.Join(subpath, entry.Name())
+		childSum, err := c.digest(childPath, childRelpath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s  %s\n", hex.EncodeToString(childSum), entry.Name())
+	}
+	return nil
+}
+
+// writeHeader hashes a canonical "type|mode|uid|gid|xattrs|size|linktarget|relpath"
+// record for the inode referenced by pathFd into h, and returns the symlink's
+// target (empty for non-symlinks). subpath is the real root-relative path
+// (needed to resolve the symlink target via the Root); relpath is the path
+// relative to the originally digested subpath (see [checksummer.digest]),
+// which is what actually gets embedded in the hashed record, so that the
+// digest of a subtree doesn't change depending on where in the root it's
+// located.
+func (c *checksummer) writeHeader(h hash.Hash, pathFd *os.File, info os.FileInfo, subpath, relpath string) (string, error) {
+	var typ string
+	switch {
+	case info.IsDir():
+		typ = "dir"
+	case info.Mode()&os.ModeSymlink != 0:
+		typ = "symlink"
+	case info.Mode().IsRegular():
+		typ = "file"
+	default:
+		typ = fmt.Sprintf("other(%s)", info.Mode().Type())
+	}
+
+	var uid, gid uint32
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid = st.Uid, st.Gid
+	}
+
+	xattrs, err := readXattrs(pathFd)
+	if err != nil {
+		return "", fmt.Errorf("read xattrs of %q: %w", subpath, err)
+	}
+
+	var linktarget string
+	if typ == "symlink" {
+		linktarget, err = c.root.Readlink(subpath)
+		if err != nil {
+			return "", fmt.Errorf("readlink %q: %w", subpath, err)
+		}
+	}
+
+	fmt.Fprintf(h, "%s|%o|%d|%d|%s|%d|%s|%s\n",
+		typ, info.Mode().Perm(), uid, gid, xattrs, info.Size(), linktarget, relpath)
+	return linktarget, nil
+}
+
+// readXattrs returns a canonical (sorted, hex-encoded) rendering of all
+// xattrs set on the inode referenced by f, suitable for inclusion in a
+// checksum header. Filesystems or inode types that don't support xattrs are
+// treated as having none.
+//
+// f is an O_PATH fd (since that's the only kind of fd [checksummer.digest]
+// can always safely open, regardless of the inode's type), and the
+// f*xattr(2) family always fails with EBADF against an O_PATH fd -- the
+// kernel never attached a real "open file description" to it. So instead we
+// go through the /proc/self/fd/N magic link: following it with the
+// non-f-prefixed *xattr(2) calls resolves back to exactly the inode f has
+// open (the magic link's special-cased resolution, not a second path
+// lookup), without ever re-walking the original (attacker-controlled) path.
+func readXattrs(f *os.File) (string, error) {
+	magicPath := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+	size, err := unix.Listxattr(magicPath, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+			return "", nil
+		}
+		return "", err
+	}
+	if size == 0 {
+		return "", nil
+	}
+	namesBuf := make([]byte, size)
+	if _, err := unix.Listxattr(magicPath, namesBuf); err != nil {
+		return "", err
+	}
+
+	var names []string
+	for _, name := range strings.Split(strings.TrimRight(string(namesBuf), "\x00"), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		vsize, err := unix.Getxattr(magicPath, name, nil)
+		if err != nil {
+			return "", fmt.Errorf("getxattr %q: %w", name, err)
+		}
+		val := make([]byte, vsize)
+		if vsize > 0 {
+			if _, err := unix.Getxattr(magicPath, name, val); err != nil {
+				return "", fmt.Errorf("getxattr %q: %w", name, err)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", name, hex.EncodeToString(val)))
+	}
+	return strings.Join(parts, ","), nil
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"cyphar.com/go-pathrs"
+	"cyphar.com/go-pathrs/archive"
+)
+
+var rootExtractTarCmd = &cli.Command{
+	Name:  "extract-tar",
+	Usage: "safely extract a tar stream (from stdin) into the root",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "preserve-owners",
+			Usage: "apply uid/gid from the tar headers to extracted inodes",
+		},
+		&cli.BoolFlag{
+			Name:  "preserve-xattrs",
+			Usage: "apply xattrs from the tar headers to extracted inodes",
+		},
+		&cli.StringFlag{
+			Name:  "whiteouts",
+			Usage: "whiteout marker convention to interpret (none, overlayfs, aufs)",
+			Value: "none",
+		},
+		&cli.BoolFlag{
+			Name:  "same-file-system",
+			Usage: "abort if the destination is not on the same filesystem as the root",
+		},
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{
+			Name: "subpath",
+		},
+	},
+
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		root := ctx.Value("root").(*pathrs.Root)
+		subpath := cmd.StringArg("subpath")
+
+		var whiteouts archive.Whiteouts
+		switch cmd.String("whiteouts") {
+		case "none":
+			whiteouts = archive.WhiteoutsNone
+		case "overlayfs":
+			whiteouts = archive.WhiteoutsOverlayFS
+		case "aufs":
+			whiteouts = archive.WhiteoutsAUFS
+		default:
+			return fmt.Errorf("invalid --whiteouts value %q", cmd.String("whiteouts"))
+		}
+
+		opts := archive.ExtractOptions{
+			PreserveOwners: cmd.Bool("preserve-owners"),
+			PreserveXattrs: cmd.Bool("preserve-xattrs"),
+			Whiteouts:      whiteouts,
+			SameFileSystem: cmd.Bool("same-file-system"),
+		}
+		return archive.ExtractTar(root, os.Stdin, subpath, opts)
+	},
+}
@@ -0,0 +1,625 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/sys/unix"
+
+	"cyphar.com/go-pathrs"
+)
+
+// serveCmd is a test-harness-only daemon: "open_root" accepts an arbitrary
+// host path and hands back fds resolved inside it, so any local process able
+// to connect to the socket gets the same access as whoever started pathrs
+// serve. It is not meant to be exposed to untrusted local users -- the
+// 0o600 perms set below are the minimum gating for that, not a green light
+// to run this on a multi-tenant host.
+var serveCmd = &cli.Command{
+	Name:  "serve",
+	Usage: "run a persistent daemon exposing Root/Handle operations over a Unix socket (test-harness use only, see doc comment)",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "socket",
+			Usage:    "path to the Unix domain socket to listen on",
+			Required: true,
+		},
+	},
+
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		socketPath := cmd.String("socket")
+
+		_ = os.Remove(socketPath) // ignore errors: socket may not exist yet
+		oldUmask := unix.Umask(0o077)
+		ln, err := net.Listen("unix", socketPath)
+		unix.Umask(oldUmask)
+		if err != nil {
+			return fmt.Errorf("listen on %q: %w", socketPath, err)
+		}
+		defer ln.Close()
+		// Belt-and-braces on top of the umask above, in case socketPath
+		// already existed with looser perms from some prior run.
+		if err := os.Chmod(socketPath, 0o600); err != nil {
+			return fmt.Errorf("chmod %q: %w", socketPath, err)
+		}
+
+		srv := newPathrsServer()
+		defer srv.closeAll()
+
+		log.Printf("pathrs serve: listening on %s", socketPath)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accept: %w", err)
+			}
+			uconn, ok := conn.(*net.UnixConn)
+			if !ok {
+				// Can't happen for a "unix" listener, but fail loudly rather
+				// than silently dropping fd-passing support.
+				conn.Close()
+				continue
+			}
+			go srv.serveConn(uconn)
+		}
+	},
+}
+
+// jsonrpcRequest is a single JSON-RPC 2.0 request, as documented at
+// https://www.jsonrpc.org/specification. Requests are line-delimited on the
+// socket (one JSON object per line).
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      any             `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// jsonrpcResponse is the line-delimited JSON-RPC 2.0 response counterpart to
+// [jsonrpcRequest].
+type jsonrpcResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      any           `json:"id,omitempty"`
+	Result  any           `json:"result,omitempty"`
+	Error   *jsonrpcError `json:"error,omitempty"`
+}
+
+// jsonrpcError is the "error" member of a [jsonrpcResponse].
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+	// jsonrpcServerError is used for errors returned by the underlying
+	// libpathrs operation itself (as opposed to protocol-level errors).
+	jsonrpcServerError = -32000
+)
+
+// pathrsServer holds the Root/Handle objects that have been handed out
+// opaque IDs via "open_root"/"resolve" (and friends), so that they can be
+// kept open across many requests on behalf of short-lived clients.
+type pathrsServer struct {
+	mu      sync.Mutex
+	roots   map[string]*pathrs.Root
+	handles map[string]*pathrs.Handle
+}
+
+func newPathrsServer() *pathrsServer {
+	return &pathrsServer{
+		roots:   make(map[string]*pathrs.Root),
+		handles: make(map[string]*pathrs.Handle),
+	}
+}
+
+func (s *pathrsServer) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, root := range s.roots {
+		_ = root.Close()
+		delete(s.roots, id)
+	}
+	for id, handle := range s.handles {
+		_ = handle.Close()
+		delete(s.handles, id)
+	}
+}
+
+// newID generates an opaque object ID handed out in "open_root"/"resolve"
+// (and similar) responses, which the client must pass back into subsequent
+// requests that operate on that object.
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *pathrsServer) getRoot(id string) (*pathrs.Root, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root, ok := s.roots[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown root id %q", id)
+	}
+	return root, nil
+}
+
+func (s *pathrsServer) getHandle(id string) (*pathrs.Handle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handle, ok := s.handles[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown handle id %q", id)
+	}
+	return handle, nil
+}
+
+func (s *pathrsServer) putRoot(root *pathrs.Root) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roots[id] = root
+	return id, nil
+}
+
+func (s *pathrsServer) putHandle(handle *pathrs.Handle) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles[id] = handle
+	return id, nil
+}
+
+// serveConn handles one client connection, dispatching line-delimited
+// JSON-RPC requests until the connection is closed.
+func (s *pathrsServer) serveConn(conn *net.UnixConn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req jsonrpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			writeResponse(conn, jsonrpcResponse{
+				JSONRPC: "2.0",
+				Error:   &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("invalid request: %v", err)},
+			}, nil)
+			continue
+		}
+
+		result, fds, err := s.dispatch(req.Method, req.Params)
+		resp := jsonrpcResponse{JSONRPC: "2.0", ID: req.ID}
+		if err != nil {
+			var rpcErr *jsonrpcError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &jsonrpcError{Code: jsonrpcServerError, Message: err.Error()}
+			}
+			resp.Error = rpcErr
+		} else {
+			resp.Result = result
+		}
+		writeResponse(conn, resp, fds)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("pathrs serve: connection error: %v", err)
+	}
+}
+
+// writeResponse marshals resp as a single line and writes it to conn. If fds
+// is non-empty, the file descriptors are attached as SCM_RIGHTS ancillary
+// data on the same sendmsg(2) call and then closed (the receiver now owns
+// the duplicated descriptors).
+func writeResponse(conn *net.UnixConn, resp jsonrpcResponse, fds []*os.File) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("pathrs serve: marshal response: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	if len(fds) == 0 {
+		if _, err := conn.Write(data); err != nil {
+			log.Printf("pathrs serve: write response: %v", err)
+		}
+		return
+	}
+	defer func() {
+		for _, f := range fds {
+			_ = f.Close()
+		}
+	}()
+
+	rawFds := make([]int, len(fds))
+	for i, f := range fds {
+		rawFds[i] = int(f.Fd())
+	}
+	rights := unix.UnixRights(rawFds...)
+	if _, _, err := conn.WriteMsgUnix(data, rights, nil); err != nil {
+		log.Printf("pathrs serve: send fds: %v", err)
+	}
+}
+
+// dispatch looks up and runs the handler for method, decoding params as that
+// handler's argument type. The returned []*os.File (if any) are sent to the
+// client as SCM_RIGHTS ancillary data alongside the JSON response.
+func (s *pathrsServer) dispatch(method string, params json.RawMessage) (any, []*os.File, error) {
+	fn, ok := rpcMethods[method]
+	if !ok {
+		return nil, nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+	}
+	return fn(s, params)
+}
+
+// rpcMethod is the signature every JSON-RPC method handler implements: decode
+// params, perform the libpathrs operation, and return a JSON-able result plus
+// any file descriptors that should be passed back via SCM_RIGHTS.
+type rpcMethod func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error)
+
+func decodeParams[T any](params json.RawMessage) (T, error) {
+	var v T
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &v); err != nil {
+			return v, &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+		}
+	}
+	return v, nil
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"open_root": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			Path string `json:"path"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := pathrs.OpenRoot(p.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := s.putRoot(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]string{"root_id": id}, nil, nil
+	},
+
+	"close_root": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID string `json:"root_id"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.mu.Lock()
+		root, ok := s.roots[p.RootID]
+		delete(s.roots, p.RootID)
+		s.mu.Unlock()
+		if ok {
+			_ = root.Close()
+		}
+		return map[string]any{"closed": ok}, nil, nil
+	},
+
+	"resolve": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+			Follow  bool   `json:"follow"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var handle *pathrs.Handle
+		if p.Follow {
+			handle, err = root.Resolve(p.Subpath)
+		} else {
+			handle, err = root.ResolveNoFollow(p.Subpath)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := s.putHandle(handle)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]string{"handle_id": id}, nil, nil
+	},
+
+	"close_handle": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			HandleID string `json:"handle_id"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.mu.Lock()
+		handle, ok := s.handles[p.HandleID]
+		delete(s.handles, p.HandleID)
+		s.mu.Unlock()
+		if ok {
+			_ = handle.Close()
+		}
+		return map[string]any{"closed": ok}, nil, nil
+	},
+
+	"reopen": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			HandleID string `json:"handle_id"`
+			Oflags   int    `json:"oflags"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		handle, err := s.getHandle(p.HandleID)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := handle.OpenFile(p.Oflags)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, []*os.File{f}, nil
+	},
+
+	"open": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+			Oflags  int    `json:"oflags"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := root.OpenFile(p.Subpath, p.Oflags)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, []*os.File{f}, nil
+	},
+
+	"create": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+			Oflags  int    `json:"oflags"`
+			Mode    uint32 `json:"mode"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := root.Create(p.Subpath, p.Oflags, os.FileMode(p.Mode))
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, []*os.File{f}, nil
+	},
+
+	"mkdir": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+			Mode    uint32 `json:"mode"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.Mkdir(p.Subpath, os.FileMode(p.Mode)); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"mkdir_all": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+			Mode    uint32 `json:"mode"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		handle, err := root.MkdirAll(p.Subpath, os.FileMode(p.Mode))
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := s.putHandle(handle)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]string{"handle_id": id}, nil, nil
+	},
+
+	"rename": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID string `json:"root_id"`
+			Src    string `json:"src"`
+			Dst    string `json:"dst"`
+			Flags  uint   `json:"flags"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.Rename(p.Src, p.Dst, p.Flags); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"hardlink": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID string `json:"root_id"`
+			Target string `json:"target"`
+			Link   string `json:"link"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.Hardlink(p.Link, p.Target); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"symlink": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID string `json:"root_id"`
+			Target string `json:"target"`
+			Link   string `json:"link"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.Symlink(p.Link, p.Target); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"readlink": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		target, err := root.Readlink(p.Subpath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]string{"target": target}, nil, nil
+	},
+
+	"remove_file": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.RemoveFile(p.Subpath); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"remove_dir": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.RemoveDir(p.Subpath); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+
+	"remove_all": func(s *pathrsServer, params json.RawMessage) (any, []*os.File, error) {
+		p, err := decodeParams[struct {
+			RootID  string `json:"root_id"`
+			Subpath string `json:"subpath"`
+		}](params)
+		if err != nil {
+			return nil, nil, err
+		}
+		root, err := s.getRoot(p.RootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := root.RemoveAll(p.Subpath); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{}, nil, nil
+	},
+}
+
+// jsonrpcError also implements error, so handlers can return it directly and
+// have [pathrsServer.serveConn] preserve the JSON-RPC error code.
+func (e *jsonrpcError) Error() string {
+	return e.Message
+}
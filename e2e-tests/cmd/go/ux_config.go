@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// configTree is a generic nested-map representation of a parsed config file,
+// keyed the same way dotted flag names (e.g. "mode" or "root.mode") are.
+type configTree map[string]any
+
+// loadConfigTree reads and parses path, picking a format based on its file
+// extension: .json via encoding/json, .yaml/.yml via [parseYAML], .toml via
+// [parseTOML]. The latter two only cover the scalar-valued (optionally
+// nested) mapping subset that configFileFlag actually needs -- see their
+// doc comments for exactly what's supported -- since this module has no
+// vendored YAML/TOML library to fall back on for the rest.
+func loadConfigTree(path string) (configTree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %q: %w", path, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		var tree configTree
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("parse JSON config %q: %w", path, err)
+		}
+		return tree, nil
+	case ".yaml", ".yml":
+		tree, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse YAML config %q: %w", path, err)
+		}
+		return tree, nil
+	case ".toml":
+		tree, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse TOML config %q: %w", path, err)
+		}
+		return tree, nil
+	default:
+		return nil, fmt.Errorf("config file %q: unrecognised extension %q (expected .json, .yaml, .yml, or .toml)", path, ext)
+	}
+}
+
+// lookup resolves a dotted key path against the config tree, descending
+// through nested objects one dot-separated component at a time.
+func (t configTree) lookup(name string) (string, bool) {
+	var cur any = map[string]any(t)
+	for _, key := range strings.Split(name, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if cur, ok = m[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	default:
+		// Numbers/bools/etc. round-trip fine through the same string
+		// parsing every other flag value already goes through.
+		return fmt.Sprintf("%v", v), true
+	}
+}
+
+// configFileFlag registers a --config flag (falling back to the
+// PATHRS_CONFIG env var) that supplies default values for every other flag
+// already registered on cmd, using each flag's own name as the dotted
+// lookup key into the config file.
+//
+// Precedence is CLI flag > env var > config file > flag default: this hook
+// only ever calls cmd.Set for a flag that cmd.IsSet reports as unset, so an
+// explicit command-line value (or an env-bound value already resolved by
+// urfave/cli, e.g. via [modeFlag]'s Sources) always wins over the config
+// file. Like the other ux options in this package, the hook chains onto
+// cmd.Before ahead of oldBefore, so later Before hooks (e.g. modeFlag's
+// parseModeFlag call) observe the config-supplied value as if it had been
+// passed on the command line.
+func configFileFlag() uxOption {
+	const name = "config"
+	const envName = "PATHRS_CONFIG"
+
+	return func(cmd *cli.Command) *cli.Command {
+		cmd.Flags = append(cmd.Flags, &cli.StringFlag{
+			Name:    name,
+			Usage:   "load default flag values from a config file (.json, .yaml/.yml, or .toml)",
+			Sources: cli.EnvVars(envName),
+		})
+
+		oldBefore := cmd.Before
+		cmd.Before = func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if cmd.IsSet(name) {
+				tree, err := loadConfigTree(cmd.String(name))
+				if err != nil {
+					return nil, fmt.Errorf("error loading --%s: %w", name, err)
+				}
+				for _, flag := range cmd.Flags {
+					flagName := flag.Names()[0]
+					if flagName == name || cmd.IsSet(flagName) {
+						continue
+					}
+					val, ok := tree.lookup(flagName)
+					if !ok {
+						continue
+					}
+					if err := cmd.Set(flagName, val); err != nil {
+						return nil, fmt.Errorf("error applying --%s value for --%s: %w", name, flagName, err)
+					}
+				}
+			}
+
+			var err error
+			if oldBefore != nil {
+				ctx, err = oldBefore(ctx, cmd)
+			}
+			return ctx, err
+		}
+
+		return cmd
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+// newConfigTestCmd builds a throwaway command wired up exactly like the real
+// subcommands in root.go (modeFlag + configFileFlag, in that order), with an
+// Action that stashes the resolved --mode value for the test to inspect.
+func newConfigTestCmd() (*cli.Command, *os.FileMode) {
+	var got os.FileMode
+	cmd := cmdWithOptions(&cli.Command{
+		Name: "test",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			got = ctx.Value("mode").(os.FileMode)
+			return nil
+		},
+	},
+		modeFlag([]string{"mode", "m"}, "PATHRS_MODE", "file mode", "0o644"),
+		configFileFlag(),
+	)
+	return cmd, &got
+}
+
+func writeConfig(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write config %q: %v", p, err)
+	}
+	return p
+}
+
+// TestConfigFilePrecedence exercises every rung of the documented
+// precedence ladder (CLI flag > env var > config file > flag default)
+// against all three supported config formats.
+func TestConfigFilePrecedence(t *testing.T) {
+	dir := t.TempDir()
+
+	configs := map[string]string{
+		"config.json": `{"mode": "0o640"}`,
+		"config.yaml": "mode: \"0o640\"\n",
+		"config.toml": "mode = \"0o640\"\n",
+	}
+
+	for name, contents := range configs {
+		t.Run(name, func(t *testing.T) {
+			configPath := writeConfig(t, dir, name, contents)
+
+			t.Run("config beats default", func(t *testing.T) {
+				cmd, got := newConfigTestCmd()
+				if err := cmd.Run(context.Background(), []string{"test", "--config", configPath}); err != nil {
+					t.Fatalf("run: %v", err)
+				}
+				if want := os.FileMode(0o640); *got != want {
+					t.Errorf("mode = %o, want %o", *got, want)
+				}
+			})
+
+			t.Run("env beats config", func(t *testing.T) {
+				t.Setenv("PATHRS_MODE", "0o600")
+				cmd, got := newConfigTestCmd()
+				if err := cmd.Run(context.Background(), []string{"test", "--config", configPath}); err != nil {
+					t.Fatalf("run: %v", err)
+				}
+				if want := os.FileMode(0o600); *got != want {
+					t.Errorf("mode = %o, want %o", *got, want)
+				}
+			})
+
+			t.Run("CLI flag beats env and config", func(t *testing.T) {
+				t.Setenv("PATHRS_MODE", "0o600")
+				cmd, got := newConfigTestCmd()
+				if err := cmd.Run(context.Background(), []string{"test", "--config", configPath, "--mode", "0o755"}); err != nil {
+					t.Fatalf("run: %v", err)
+				}
+				if want := os.FileMode(0o755); *got != want {
+					t.Errorf("mode = %o, want %o", *got, want)
+				}
+			})
+		})
+	}
+
+	t.Run("default wins with no config/env/CLI", func(t *testing.T) {
+		cmd, got := newConfigTestCmd()
+		if err := cmd.Run(context.Background(), []string{"test"}); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if want := os.FileMode(0o644); *got != want {
+			t.Errorf("mode = %o, want %o", *got, want)
+		}
+	})
+}
+
+// TestConfigFileModeInteraction confirms that mode strings supplied via a
+// YAML config file still parse through parseModeFlag the same way
+// command-line values would: a symbolic --mode folded against an octal
+// config-supplied --mode-base.
+func TestConfigFileModeInteraction(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeConfig(t, dir, "config.yaml", "mode: \"u+rwx,g=rx\"\nmode-base: \"0o600\"\n")
+
+	cmd, got := newConfigTestCmd()
+	if err := cmd.Run(context.Background(), []string{"test", "--config", configPath}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := os.FileMode(0o750); *got != want {
+		t.Errorf("mode = %o, want %o", *got, want)
+	}
+}
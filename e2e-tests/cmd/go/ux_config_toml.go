@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the restricted subset of TOML a --config file actually
+// needs: top-level "key = value" scalar assignments and "[table]"/
+// "[table.sub]" headers that nest subsequent assignments under the
+// corresponding dotted path, e.g.
+//
+//	mode = "0o644"
+//
+//	[root]
+//	output = "json"
+//
+// Arrays, inline tables, multi-line strings, and table-arrays ("[[...]]")
+// are not supported -- same rationale as [parseYAML]: this module has no
+// vendored TOML library, and every flag configFileFlag looks up is a single
+// scalar, so this only needs to cover scalar assignments under (possibly
+// nested) table headers.
+func parseTOML(data []byte) (configTree, error) {
+	// Nested tables are stored as plain map[string]any (not configTree) so
+	// that [configTree.lookup]'s `cur.(map[string]any)` type assertion --
+	// written against what json.Unmarshal produces for nested objects --
+	// also matches the tables built here.
+	root := make(map[string]any)
+	cur := root
+
+	for lineNo, rawLine := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(stripTOMLComment(rawLine))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			header, ok := strings.CutSuffix(strings.TrimPrefix(line, "["), "]")
+			if !ok {
+				return nil, fmt.Errorf("line %d: malformed table header %q", lineNo+1, line)
+			}
+			cur = root
+			for _, key := range strings.Split(strings.TrimSpace(header), ".") {
+				key = strings.TrimSpace(key)
+				child, ok := cur[key].(map[string]any)
+				if !ok {
+					child = make(map[string]any)
+					cur[key] = child
+				}
+				cur = child
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\", got %q", lineNo+1, line)
+		}
+		cur[strings.TrimSpace(key)] = unquoteTOMLScalar(strings.TrimSpace(value))
+	}
+	return configTree(root), nil
+}
+
+// stripTOMLComment removes a trailing "# ..." comment, ignoring '#'
+// characters inside a quoted scalar.
+func stripTOMLComment(line string) string {
+	inQuote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inQuote != 0:
+			if c == inQuote {
+				inQuote = 0
+			}
+		case c == '\'' || c == '"':
+			inQuote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteTOMLScalar strips a matching pair of quotes from a scalar value (if
+// present), otherwise returns it verbatim (TOML also allows bare integers,
+// floats, and booleans, which round-trip fine as plain strings the same way
+// [configTree.lookup] already handles JSON numbers/bools).
+func unquoteTOMLScalar(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	switch value[0] {
+	case '"':
+		if value[len(value)-1] != '"' {
+			return value
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	case '\'':
+		if value[len(value)-1] != '\'' {
+			return value
+		}
+		return value[1 : len(value)-1]
+	default:
+		return value
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the restricted subset of YAML that a --config file
+// actually needs to express: a (possibly nested, via 2-space indentation)
+// mapping of scalar keys to scalar values, e.g.
+//
+//	mode: "0o644"
+//	root:
+//	  output: json
+//
+// Lists, anchors/aliases, flow ("{...}"/"[...]") syntax, and multi-line
+// scalars are not supported -- this module has no vendored YAML library, and
+// every flag configFileFlag ever looks up is itself a single scalar value,
+// so a full parser would be solving a problem this CLI doesn't have.
+func parseYAML(data []byte) (configTree, error) {
+	// Nested mappings are stored as plain map[string]any (not configTree)
+	// so that [configTree.lookup]'s `cur.(map[string]any)` type assertion
+	// -- written against what json.Unmarshal produces for nested objects --
+	// also matches the mappings built here.
+	root := make(map[string]any)
+	stack := []struct {
+		indent int
+		tree   map[string]any
+	}{{indent: -1, tree: root}}
+
+	for lineNo, rawLine := range strings.Split(string(data), "\n") {
+		line := stripYAMLComment(rawLine)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		trimmed := strings.TrimSpace(line)
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\", got %q", lineNo+1, trimmed)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		for len(stack) > 1 && indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].tree
+
+		if value == "" {
+			// A bare "key:" introduces a nested mapping on the following
+			// more-indented lines.
+			child := make(map[string]any)
+			parent[key] = child
+			stack = append(stack, struct {
+				indent int
+				tree   map[string]any
+			}{indent: indent, tree: child})
+			continue
+		}
+		parent[key] = unquoteYAMLScalar(value)
+	}
+	return configTree(root), nil
+}
+
+// stripYAMLComment removes a trailing "# ..." comment, ignoring '#'
+// characters inside a quoted scalar.
+func stripYAMLComment(line string) string {
+	inQuote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inQuote != 0:
+			if c == inQuote {
+				inQuote = 0
+			}
+		case c == '\'' || c == '"':
+			inQuote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteYAMLScalar strips a matching pair of quotes from a scalar value (if
+// present), otherwise returns it verbatim. Numeric/bool-looking scalars are
+// deliberately left as plain strings, same as [configTree.lookup] already
+// expects from the JSON path.
+func unquoteYAMLScalar(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	switch value[0] {
+	case '"':
+		if value[len(value)-1] != '"' {
+			return value
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	case '\'':
+		if value[len(value)-1] != '\'' {
+			return value
+		}
+		return value[1 : len(value)-1]
+	default:
+		return value
+	}
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+// ioFlags registers the --input/--output-file content-pipeline flags shared
+// by the commands that stream data through an opened handle.
+//
+// The streaming flag is named "output-file" rather than "output" because
+// root's own --output flag (text/json/jsonl result formatting, see root.go)
+// is a parent flag these commands inherit: urfave/cli resolves a flag name
+// against the nearest command that declares it, so a subcommand-local
+// "output" flag here would silently shadow the parent one instead of
+// erroring, and --output=json would be swallowed as a (nonsensical)
+// destination path instead of selecting the JSON result format.
+func ioFlags() uxOption {
+	return func(cmd *cli.Command) *cli.Command {
+		cmd.Flags = append(cmd.Flags,
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: "copy contents from this path (\"-\" for stdin) into the handle",
+			},
+			&cli.StringFlag{
+				Name:  "output-file",
+				Usage: "copy the handle's contents to this path (\"-\" for stdout)",
+			},
+		)
+		return cmd
+	}
+}
+
+// streamInput copies the contents of --input (if set) into f, so that the
+// handle's bytes can be supplied in a shell pipeline rather than requiring the
+// caller to touch the resolved path directly.
+func streamInput(f *os.File, input string) error {
+	if input == "" {
+		return nil
+	}
+	r := io.Reader(os.Stdin)
+	if input != "-" {
+		in, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("open --input %q: %w", input, err)
+		}
+		defer in.Close() //nolint:errcheck // Close errors are not critical
+		r = in
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("copy --input %q to handle: %w", input, err)
+	}
+	return nil
+}
+
+// streamOutput copies the contents of f to --output-file (if set), so that
+// the handle's bytes can be consumed in a shell pipeline rather than
+// requiring the caller to touch the resolved path directly.
+func streamOutput(f *os.File, output string) error {
+	if output == "" {
+		return nil
+	}
+	w := io.Writer(os.Stdout)
+	if output != "-" {
+		out, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("open --output-file %q: %w", output, err)
+		}
+		defer out.Close() //nolint:errcheck // Close errors are not critical
+		w = out
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("copy handle contents to --output-file %q: %w", output, err)
+	}
+	return nil
+}
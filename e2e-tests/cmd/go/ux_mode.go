@@ -22,15 +22,33 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func parseModeFlag(modeStr string) (os.FileMode, error) {
+// isOctalMode reports whether modeStr looks like an octal mode (optionally
+// "0o"-prefixed) rather than a chmod(1)-style symbolic clause list.
+func isOctalMode(modeStr string) bool {
+	modeStr = strings.TrimPrefix(modeStr, "0o")
+	if modeStr == "" {
+		return false
+	}
+	for _, ch := range modeStr {
+		if ch < '0' || ch > '7' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOctalMode parses a plain (optionally "0o"-prefixed) octal mode string,
+// translating the setuid/setgid/sticky bits into their os.FileMode
+// equivalents.
+func parseOctalMode(modeStr string) (os.FileMode, error) {
 	modeStr = strings.TrimPrefix(modeStr, "0o")
 
 	unixMode, err := strconv.ParseUint(modeStr, 8, 32)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse --mode: %w", err)
+		return 0, fmt.Errorf("failed to parse mode: %w", err)
 	}
 	if unixMode&^0o7777 != 0 {
-		return 0, fmt.Errorf("invalid --mode %#o: must be subset of 0o7777")
+		return 0, fmt.Errorf("invalid mode %#o: must be subset of 0o7777", unixMode)
 	}
 
 	mode := os.FileMode(unixMode & 0o777)
@@ -46,21 +64,221 @@ func parseModeFlag(modeStr string) (os.FileMode, error) {
 	return mode, nil
 }
 
-func modeFlag(name, usage, dfl string) uxOption {
+// modeBit returns the os.FileMode bit for a single r/w/x permission letter,
+// as it applies to a single "who" letter ('u', 'g', 'o', or 'a' for all
+// three).
+func modeBit(who, perm rune) os.FileMode {
+	var bit os.FileMode
+	switch perm {
+	case 'r':
+		bit = 0o4
+	case 'w':
+		bit = 0o2
+	case 'x':
+		bit = 0o1
+	}
+	switch who {
+	case 'u':
+		return bit << 6
+	case 'g':
+		return bit << 3
+	case 'o':
+		return bit
+	case 'a':
+		return (bit << 6) | (bit << 3) | bit
+	}
+	return 0
+}
+
+// applyModeClause applies a single chmod(1)-style "[ugoa]*op[rwxXst]*" clause
+// (already split into its who/op/perms parts) against mode.
+func applyModeClause(mode os.FileMode, who string, op byte, perms string) (os.FileMode, error) {
+	if who == "" {
+		who = "a"
+	}
+
+	hasExecAnywhere := mode&0o111 != 0
+	var set os.FileMode
+	for _, p := range perms {
+		switch p {
+		case 'r', 'w', 'x':
+			for _, w := range who {
+				set |= modeBit(w, p)
+			}
+		case 'X':
+			// Only propagates an existing execute bit; unlike chmod(1) we
+			// have no lstat available here to also set it for directories.
+			if hasExecAnywhere {
+				for _, w := range who {
+					set |= modeBit(w, 'x')
+				}
+			}
+		case 's':
+			for _, w := range who {
+				switch w {
+				case 'u', 'a':
+					set |= os.ModeSetuid
+				}
+				switch w {
+				case 'g', 'a':
+					set |= os.ModeSetgid
+				}
+			}
+		case 't':
+			set |= os.ModeSticky
+		default:
+			return 0, fmt.Errorf("unknown permission %q", p)
+		}
+	}
+
+	var regularMask, specialMask os.FileMode
+	for _, w := range who {
+		switch w {
+		case 'u':
+			regularMask |= 0o700
+			specialMask |= os.ModeSetuid
+		case 'g':
+			regularMask |= 0o070
+			specialMask |= os.ModeSetgid
+		case 'o':
+			regularMask |= 0o007
+		case 'a':
+			regularMask |= 0o777
+			specialMask |= os.ModeSetuid | os.ModeSetgid
+		}
+	}
+
+	switch op {
+	case '+':
+		mode |= set
+	case '-':
+		mode &^= set
+	case '=':
+		mode = mode&^(regularMask|specialMask) | set
+	default:
+		return 0, fmt.Errorf("unknown operator %q", op)
+	}
+	return mode, nil
+}
+
+// parseSymbolicMode parses a comma-separated list of chmod(1)-style clauses
+// (e.g. "u+rwx,g=rx,o-w" or "a+X"), folding each clause against base in turn.
+func parseSymbolicMode(modeStr string, base os.FileMode) (os.FileMode, error) {
+	mode := base
+	for _, clause := range strings.Split(modeStr, ",") {
+		if clause == "" {
+			return 0, fmt.Errorf("invalid mode clause: empty clause")
+		}
+
+		i := 0
+		for i < len(clause) && strings.ContainsRune("ugoa", rune(clause[i])) {
+			i++
+		}
+		who, rest := clause[:i], clause[i:]
+		if rest == "" {
+			return 0, fmt.Errorf("invalid mode clause %q: missing operator", clause)
+		}
+
+		for len(rest) > 0 {
+			op := rest[0]
+			if op != '+' && op != '-' && op != '=' {
+				return 0, fmt.Errorf("invalid mode clause %q: expected [-+=], got %q", clause, op)
+			}
+			rest = rest[1:]
+
+			permEnd := 0
+			for permEnd < len(rest) && strings.ContainsRune("rwxXst", rune(rest[permEnd])) {
+				permEnd++
+			}
+
+			var err error
+			mode, err = applyModeClause(mode, who, op, rest[:permEnd])
+			if err != nil {
+				return 0, fmt.Errorf("invalid mode clause %q: %w", clause, err)
+			}
+			rest = rest[permEnd:]
+		}
+	}
+	return mode, nil
+}
+
+// parseModeFlag parses a --mode value, which is either a plain octal mode
+// (as accepted by chmod(1), with an optional "0o" prefix) or a
+// comma-separated list of chmod(1)-style symbolic clauses (e.g.
+// "u+rwx,g=rx,o-w", "a+X"). Symbolic clauses are folded against base, so
+// that e.g. "+x" only ever adds to whatever base already grants; an octal
+// mode string is always absolute and ignores base entirely.
+func parseModeFlag(modeStr string, base os.FileMode) (os.FileMode, error) {
+	if isOctalMode(modeStr) {
+		return parseOctalMode(modeStr)
+	}
+	return parseSymbolicMode(modeStr, base)
+}
+
+// modeFlag registers a --<names[0]> flag (with names[1:] as additional
+// aliases, e.g. "-m"), bound to the env var env, plus --<names[0]>-base and
+// --umask siblings. The resolved value is parsed into an os.FileMode via
+// [parseModeFlag] and stored in the context under the canonical names[0],
+// so existing callers that only know about the "mode" key keep working
+// regardless of which alias or env var actually supplied the value.
+//
+// --<names[0]>-base supplies the starting mode that symbolic --<names[0]>
+// clauses are folded against (octal; defaults to 0). --umask (octal) is
+// applied to the final mode afterwards, letting callers emulate
+// open(O_CREAT)'s umask-masking semantics.
+func modeFlag(names []string, env, usage, dfl string) uxOption {
+	name := names[0]
+	baseName := name + "-base"
+	const umaskName = "umask"
+
 	return func(cmd *cli.Command) *cli.Command {
-		cmd.Flags = append(cmd.Flags, &cli.StringFlag{
-			Name:  name,
-			Usage: usage,
-			Value: dfl,
-		})
+		cmd.Flags = append(cmd.Flags,
+			&cli.StringFlag{
+				Name:    name,
+				Aliases: names[1:],
+				Usage:   usage,
+				Value:   dfl,
+				Sources: cli.EnvVars(env),
+			},
+			&cli.StringFlag{
+				Name:  baseName,
+				Usage: fmt.Sprintf("starting mode (octal) that symbolic --%s clauses are folded against", name),
+			},
+			&cli.StringFlag{
+				Name:  umaskName,
+				Usage: fmt.Sprintf("umask (octal) applied to the resulting --%s", name),
+			},
+		)
 
 		// TODO: Should we wrap Action instead?
 		oldBefore := cmd.Before
 		cmd.Before = func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
-			mode, err := parseModeFlag(cmd.String(name))
+			var base os.FileMode
+			if cmd.IsSet(baseName) {
+				var err error
+				base, err = parseOctalMode(cmd.String(baseName))
+				if err != nil {
+					return nil, fmt.Errorf("error parsing --%s: %w", baseName, err)
+				}
+			}
+
+			// cmd.String(name) reflects whatever urfave/cli already
+			// resolved from the CLI flag/alias, env var, or Value default
+			// (in that order), so we don't need to special-case env
+			// ourselves here.
+			mode, err := parseModeFlag(cmd.String(name), base)
 			if err != nil {
 				return nil, fmt.Errorf("error parsing --%s: %w", name, err)
 			}
+
+			if cmd.IsSet(umaskName) {
+				umask, err := parseOctalMode(cmd.String(umaskName))
+				if err != nil {
+					return nil, fmt.Errorf("error parsing --%s: %w", umaskName, err)
+				}
+				mode &^= umask
+			}
+
 			ctx = context.WithValue(ctx, name, mode)
 			if oldBefore != nil {
 				ctx, err = oldBefore(ctx, cmd)
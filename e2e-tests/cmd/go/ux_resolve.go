@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 SUSE LLC
+ * Copyright (C) 2026 Aleksa Sarai <cyphar@cyphar.com>
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"cyphar.com/go-pathrs"
+)
+
+var resolveFlagValues = map[string]pathrs.ResolverFlags{
+	"RESOLVE_NO_XDEV":       pathrs.ResolveNoXDev,
+	"RESOLVE_NO_MAGICLINKS": pathrs.ResolveNoMagiclinks,
+	"RESOLVE_NO_SYMLINKS":   pathrs.ResolveNoSymlinks,
+	"RESOLVE_BENEATH":       pathrs.ResolveBeneath,
+	"RESOLVE_IN_ROOT":       pathrs.ResolveInRoot,
+	"RESOLVE_CACHED":        pathrs.ResolveCached,
+}
+
+func parseResolveFlags(flags string) (pathrs.ResolverFlags, error) {
+	resolveFieldsFunc := func(ch rune) bool {
+		return ch == '|' || ch == ','
+	}
+
+	var resolveFlags pathrs.ResolverFlags
+	for flag := range strings.FieldsFuncSeq(flags, resolveFieldsFunc) {
+		// Convert any flags to -> RESOLVE_*.
+		flag = strings.ToUpper(flag)
+		if !strings.HasPrefix(flag, "RESOLVE_") {
+			flag = "RESOLVE_" + flag
+		}
+		val, ok := resolveFlagValues[flag]
+		if !ok {
+			return 0, fmt.Errorf("unknown flag name %q", flag)
+		}
+		resolveFlags |= val
+	}
+	return resolveFlags, nil
+}
+
+// resolveFlag registers a --<name> flag (mirroring oflags) that parses a
+// comma- or |-separated list of RESOLVE_* names into a pathrs.ResolverFlags,
+// stored in the context under name.
+func resolveFlag(name, usage string) uxOption {
+	return func(cmd *cli.Command) *cli.Command {
+		cmd.Flags = append(cmd.Flags, &cli.StringFlag{
+			Name:  name,
+			Usage: usage + " (comma- or |-separated)",
+		})
+
+		oldBefore := cmd.Before
+		cmd.Before = func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			var resolveFlags pathrs.ResolverFlags
+			if cmd.IsSet(name) {
+				var err error
+				resolveFlags, err = parseResolveFlags(cmd.String(name))
+				if err != nil {
+					return nil, fmt.Errorf("error parsing --%s: %w", name, err)
+				}
+			}
+			ctx = context.WithValue(ctx, name, resolveFlags)
+
+			var err error
+			if oldBefore != nil {
+				ctx, err = oldBefore(ctx, cmd)
+			}
+			return ctx, err
+		}
+
+		return cmd
+	}
+}
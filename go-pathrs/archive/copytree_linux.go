@@ -0,0 +1,91 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package archive
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"golang.org/x/sys/unix"
+
+	"cyphar.com/go-pathrs"
+)
+
+// CopyTree recursively copies srcSubpath (within src's directory tree) to
+// dstSubpath (within dst's directory tree). src and dst may be the same
+// Root. Every entry is read via src's safe [pathrs.Root.Walk] and
+// materialized via dst's safe Root operations, so the copy can never read
+// from or write to anything outside either root, regardless of symlinks
+// encountered along the way. Special files (devices, fifos, sockets) are
+// skipped.
+func CopyTree(dst *pathrs.Root, dstSubpath string, src *pathrs.Root, srcSubpath string) error {
+	return src.Walk(srcSubpath, func(relpath string, handle *pathrs.Handle, d fs.DirEntry) error {
+		dstPath := path.Join(dstSubpath, relpath)
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			handle, err := dst.MkdirAll(dstPath, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			handle.Close()
+			return nil
+
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := src.Readlink(path.Join(srcSubpath, relpath))
+			if err != nil {
+				return fmt.Errorf("readlink %q: %w", relpath, err)
+			}
+			return dst.Symlink(dstPath, target)
+
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			srcFile, err := handle.OpenFile(unix.O_RDONLY)
+			if err != nil {
+				return fmt.Errorf("open %q: %w", relpath, err)
+			}
+			defer srcFile.Close()
+
+			if parent := path.Dir(dstPath); parent != "." {
+				parentHandle, err := dst.MkdirAll(parent, 0o755)
+				if err != nil {
+					return fmt.Errorf("create parent directories for %q: %w", relpath, err)
+				}
+				parentHandle.Close()
+			}
+			dstFile, err := dst.Create(dstPath, unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC, info.Mode().Perm())
+			if err != nil {
+				return fmt.Errorf("create %q: %w", relpath, err)
+			}
+			defer dstFile.Close()
+
+			if _, err := io.Copy(dstFile, srcFile); err != nil {
+				return fmt.Errorf("copy %q: %w", relpath, err)
+			}
+			return nil
+
+		default:
+			return nil // skip devices, fifos, and sockets
+		}
+	})
+}
@@ -0,0 +1,342 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+// Package archive provides safe archive extraction on top of a
+// [pathrs.Root], so that path traversal, symlink-escape, and
+// hardlink-to-outside-root attacks embedded in an untrusted archive are
+// structurally impossible.
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"cyphar.com/go-pathrs"
+)
+
+// Whiteouts selects how whiteout marker files within a tar stream are
+// interpreted during extraction.
+type Whiteouts int
+
+const (
+	// WhiteoutsNone disables whiteout handling entirely: ".wh."-prefixed
+	// entries are extracted as regular files, like any other entry.
+	WhiteoutsNone Whiteouts = iota
+	// WhiteoutsOverlayFS interprets "<dir>/.wh.<name>" entries as
+	// overlayfs-style whiteouts (materialized as a 0/0 character device) and
+	// "<dir>/.wh..wh..opq" as an opaque-directory marker.
+	WhiteoutsOverlayFS
+	// WhiteoutsAUFS interprets "<dir>/.wh.<name>" entries as aufs-style
+	// whiteouts (materialized by simply removing the shadowed entry). aufs
+	// has no opaque-directory marker, so ".wh..wh..opq" entries are ignored.
+	WhiteoutsAUFS
+)
+
+// ExtractOptions configures [ExtractTar].
+type ExtractOptions struct {
+	// PreserveOwners applies the uid/gid (or the result of Chown, if set)
+	// from each tar header to the extracted inode.
+	PreserveOwners bool
+	// PreserveXattrs applies the PAXRecords-derived xattrs from each tar
+	// header to the extracted inode.
+	PreserveXattrs bool
+	// Whiteouts selects how whiteout markers are interpreted.
+	Whiteouts Whiteouts
+	// Chown, if set, overrides the uid/gid that PreserveOwners would
+	// otherwise apply verbatim, letting callers remap ownership (e.g. for
+	// rootless unpacking).
+	Chown func(hdr *tar.Header) (uid, gid int)
+	// SameFileSystem aborts extraction if dstSubpath does not resolve to the
+	// same filesystem as the root itself.
+	SameFileSystem bool
+}
+
+// ExtractTar extracts the tar stream read from r into dstSubpath inside
+// root's directory tree.
+//
+// Every entry is materialized exclusively through Root operations
+// (root.MkdirAll, root.Create, root.Symlink, root.Hardlink, root.Mknod), so
+// a malicious tar stream containing "../" path traversal, a symlink
+// attempting to escape the root, or a hardlink targeting a path outside the
+// root cannot succeed -- those operations simply fail, exactly as they
+// would for any other caller of the safe Root API.
+func ExtractTar(root *pathrs.Root, r io.Reader, dstSubpath string, opts ExtractOptions) error {
+	if opts.SameFileSystem {
+		if err := checkSameFileSystem(root, dstSubpath); err != nil {
+			return err
+		}
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+		if err := extractEntry(root, dstSubpath, hdr, tr, opts); err != nil {
+			return fmt.Errorf("extract %q: %w", hdr.Name, err)
+		}
+	}
+}
+
+func extractEntry(root *pathrs.Root, dstSubpath string, hdr *tar.Header, r io.Reader, opts ExtractOptions) error {
+	name := path.Clean("/" + hdr.Name)
+	if name == "/" {
+		return nil
+	}
+	name = strings.TrimPrefix(name, "/")
+	dstPath := path.Join(dstSubpath, name)
+
+	if opts.Whiteouts != WhiteoutsNone && strings.HasPrefix(path.Base(name), ".wh.") {
+		return extractWhiteout(root, dstSubpath, name, opts)
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		handle, err := root.MkdirAll(dstPath, fileModeFromTarMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		handle.Close()
+		return applyMetadata(root, dstPath, hdr, opts)
+
+	case tar.TypeReg, tar.TypeRegA:
+		if parent := path.Dir(dstPath); parent != "." {
+			parentHandle, err := root.MkdirAll(parent, 0o755)
+			if err != nil {
+				return fmt.Errorf("create parent directories: %w", err)
+			}
+			parentHandle.Close()
+		}
+		f, err := root.Create(dstPath, unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC, fileModeFromTarMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("write contents: %w", err)
+		}
+		return applyMetadata(root, dstPath, hdr, opts)
+
+	case tar.TypeSymlink:
+		if err := root.Symlink(dstPath, hdr.Linkname); err != nil {
+			return err
+		}
+		return applyMetadata(root, dstPath, hdr, opts)
+
+	case tar.TypeLink:
+		target := path.Join(dstSubpath, path.Clean("/"+hdr.Linkname))
+		return root.Hardlink(dstPath, target)
+
+	case tar.TypeChar:
+		return mknodEntry(root, dstPath, hdr, opts, os.ModeCharDevice|os.ModeDevice)
+	case tar.TypeBlock:
+		return mknodEntry(root, dstPath, hdr, opts, os.ModeDevice)
+	case tar.TypeFifo:
+		return mknodEntry(root, dstPath, hdr, opts, os.ModeNamedPipe)
+
+	default:
+		return fmt.Errorf("unsupported tar entry type %v", hdr.Typeflag)
+	}
+}
+
+// fileModeFromTarMode converts hdr.Mode's raw POSIX permission bits (which
+// tar/archive encodes the same way st_mode does: setuid/setgid/sticky as
+// 0o4000/0o2000/0o1000, not as os.FileMode's separate high bits) into an
+// os.FileMode's perm bits, translating the three special bits explicitly so
+// callers don't need to (a plain "& 0o7777" cast would fold them into the
+// wrong bits, matching neither tar's nor os.FileMode's encoding).
+func fileModeFromTarMode(mode int64) os.FileMode {
+	perm := os.FileMode(mode & 0o777)
+	if mode&unix.S_ISUID != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm
+}
+
+func mknodEntry(root *pathrs.Root, dstPath string, hdr *tar.Header, opts ExtractOptions, typeBits os.FileMode) error {
+	mode := fileModeFromTarMode(hdr.Mode) | typeBits
+	dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+	if err := root.Mknod(dstPath, mode, int(dev)); err != nil {
+		return err
+	}
+	return applyMetadata(root, dstPath, hdr, opts)
+}
+
+// extractWhiteout converts a ".wh."-prefixed tar entry into the filesystem
+// operation the selected Whiteouts convention says it should produce.
+func extractWhiteout(root *pathrs.Root, dstSubpath, name string, opts ExtractOptions) error {
+	dir, base := path.Split(name)
+
+	if base == ".wh..wh..opq" {
+		if opts.Whiteouts != WhiteoutsOverlayFS {
+			return nil // aufs has no opaque marker
+		}
+		return setOpaqueXattr(root, path.Join(dstSubpath, dir))
+	}
+
+	targetPath := path.Join(dstSubpath, dir, strings.TrimPrefix(base, ".wh."))
+	switch opts.Whiteouts {
+	case WhiteoutsOverlayFS:
+		// A whiteout always wins over whatever (if anything) the lower
+		// layers left behind at this path.
+		_ = root.RemoveAll(targetPath)
+		return root.Mknod(targetPath, os.ModeDevice|os.ModeCharDevice, 0)
+	case WhiteoutsAUFS:
+		_ = root.RemoveAll(targetPath)
+		return nil
+	default:
+		return nil
+	}
+}
+
+// applyMetadata applies the PreserveOwners/PreserveXattrs options, plus (for
+// directory entries) the tar header's mode, to the already-extracted entry
+// at dstPath. The directory chmod isn't gated behind PreserveOwners/
+// PreserveXattrs, because it's not optional metadata preservation -- it's
+// fixing up the one case MkdirAll's create-time mode can't reach: a
+// directory that was first implicitly created as some later entry's parent
+// (see the TypeReg branch of extractEntry, which always uses 0o755 for
+// that), whose real permissions only show up once its own TypeDir header is
+// read, by which point MkdirAll leaves the already-existing directory
+// untouched rather than re-chmod-ing it.
+//
+// Because fchmod(2)/fsetxattr(2) don't accept O_PATH descriptors, chmod and
+// setxattr follow the usual /proc/self/fd magic link (and chown uses
+// fchownat(2)'s AT_EMPTY_PATH on the fd) so that the operation still targets
+// the exact inode we just created (rather than re-resolving dstPath, which
+// would reopen a TOCTOU window).
+func applyMetadata(root *pathrs.Root, dstPath string, hdr *tar.Header, opts ExtractOptions) error {
+	chmodDir := hdr.Typeflag == tar.TypeDir
+	if !opts.PreserveOwners && !opts.PreserveXattrs && !chmodDir {
+		return nil
+	}
+
+	handle, err := root.ResolveNoFollow(dstPath)
+	if err != nil {
+		return fmt.Errorf("resolve %q for metadata: %w", dstPath, err)
+	}
+	defer handle.Close()
+
+	f, err := handle.OpenFile(unix.O_PATH | unix.O_NOFOLLOW)
+	if err != nil {
+		return fmt.Errorf("open %q for metadata: %w", dstPath, err)
+	}
+	defer f.Close()
+	magicLink := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+	if chmodDir {
+		// chmod(2) (unlike chown) always follows the final symlink and has
+		// no NOFOLLOW variant, but that's moot here: directory entries are
+		// never symlinks. hdr.Mode is already in raw st_mode form (the same
+		// encoding chmod(2) expects), so there's no os.FileMode round-trip
+		// to do here the way fileModeFromTarMode needs for MkdirAll/Create.
+		if err := unix.Fchmodat(unix.AT_FDCWD, magicLink, uint32(hdr.Mode&0o7777), 0); err != nil {
+			return fmt.Errorf("chmod %q: %w", dstPath, err)
+		}
+	}
+
+	if opts.PreserveOwners {
+		uid, gid := hdr.Uid, hdr.Gid
+		if opts.Chown != nil {
+			uid, gid = opts.Chown(hdr)
+		}
+		// fchownat(2) does accept an O_PATH fd with AT_EMPTY_PATH, which
+		// chowns exactly the inode f refers to -- for a symlink entry that is
+		// the symlink itself (the lchown(2)-equivalent), since f was opened
+		// with O_NOFOLLOW.
+		if err := unix.Fchownat(int(f.Fd()), "", uid, gid, unix.AT_EMPTY_PATH); err != nil {
+			return fmt.Errorf("chown %q: %w", dstPath, err)
+		}
+	}
+	if opts.PreserveXattrs {
+		const xattrPrefix = "SCHILY.xattr."
+		for name, value := range hdr.PAXRecords {
+			xattrName, ok := strings.CutPrefix(name, xattrPrefix)
+			if !ok {
+				continue
+			}
+			if err := unix.Setxattr(magicLink, xattrName, []byte(value), 0); err != nil {
+				return fmt.Errorf("setxattr %q on %q: %w", xattrName, dstPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setOpaqueXattr(root *pathrs.Root, dirPath string) error {
+	handle, err := root.Resolve(dirPath)
+	if err != nil {
+		return fmt.Errorf("resolve %q for opaque marker: %w", dirPath, err)
+	}
+	defer handle.Close()
+
+	f, err := handle.OpenFile(unix.O_PATH)
+	if err != nil {
+		return fmt.Errorf("open %q for opaque marker: %w", dirPath, err)
+	}
+	defer f.Close()
+
+	magicLink := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+	return unix.Setxattr(magicLink, "trusted.overlay.opaque", []byte("y"), 0)
+}
+
+// checkSameFileSystem implements ExtractOptions.SameFileSystem by comparing
+// the f_fsid of the root and of dstSubpath (creating it first if necessary).
+func checkSameFileSystem(root *pathrs.Root, dstSubpath string) error {
+	rootFile, err := root.Open(".")
+	if err != nil {
+		return fmt.Errorf("open root for filesystem check: %w", err)
+	}
+	defer rootFile.Close()
+	var rootStatfs unix.Statfs_t
+	if err := unix.Fstatfs(int(rootFile.Fd()), &rootStatfs); err != nil {
+		return fmt.Errorf("statfs root: %w", err)
+	}
+
+	handle, err := root.MkdirAll(dstSubpath, 0o755)
+	if err != nil {
+		return fmt.Errorf("resolve %q for filesystem check: %w", dstSubpath, err)
+	}
+	defer handle.Close()
+	dstFile, err := handle.OpenFile(unix.O_PATH)
+	if err != nil {
+		return fmt.Errorf("open %q for filesystem check: %w", dstSubpath, err)
+	}
+	defer dstFile.Close()
+	var dstStatfs unix.Statfs_t
+	if err := unix.Fstatfs(int(dstFile.Fd()), &dstStatfs); err != nil {
+		return fmt.Errorf("statfs %q: %w", dstSubpath, err)
+	}
+
+	if rootStatfs.Fsid != dstStatfs.Fsid {
+		return fmt.Errorf("%q is on a different filesystem to the root (SameFileSystem)", dstSubpath)
+	}
+	return nil
+}
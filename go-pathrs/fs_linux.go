@@ -0,0 +1,182 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// RootFS adapts a [Root] to the standard [io/fs.FS] interface (and the
+// ReadDirFS/ReadFileFS/StatFS/SubFS extension interfaces), so that a safe
+// root can be handed to any library that only knows how to consume io/fs --
+// archive/tar, text/template, html/template, or net/http's http.FS, for
+// example -- without losing the symlink-escape protection libpathrs
+// provides.
+//
+// Every method is implemented in terms of Root's safe resolver, never by
+// operating on name as a host path. As required by io/fs, name arguments
+// must satisfy [fs.ValidPath]: they are slash-separated, relative to the
+// root (never to the host filesystem), and "." refers to the root itself.
+type RootFS struct {
+	root   *Root
+	follow bool
+}
+
+// RootFSOption configures the [io/fs.FS] adapter returned by [Root.FS].
+type RootFSOption func(*RootFS)
+
+// FollowSymlinks makes every method of the adapter resolve a trailing
+// symlink at the requested path. By default the final path component is not
+// followed: Open (and ReadFile, which is built on it) fails with ELOOP the
+// way O_NOFOLLOW would, and ReadDir/Stat/Sub resolve the path with
+// [Root.ResolveNoFollow].
+func FollowSymlinks() RootFSOption {
+	return func(fsys *RootFS) { fsys.follow = true }
+}
+
+// FS returns an [io/fs.FS] view of r. By default, the final component of
+// any path is resolved with O_NOFOLLOW semantics (matching [Root.ResolveNoFollow]);
+// pass [FollowSymlinks] to follow a trailing symlink instead.
+func (r *Root) FS(opts ...RootFSOption) *RootFS {
+	fsys := &RootFS{root: r}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	return fsys
+}
+
+func (fsys *RootFS) resolve(name string) (*Handle, error) {
+	if fsys.follow {
+		return fsys.root.Resolve(name)
+	}
+	return fsys.root.ResolveNoFollow(name)
+}
+
+// Open implements [io/fs.FS].
+func (fsys *RootFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	oflags := unix.O_RDONLY
+	if !fsys.follow {
+		oflags |= unix.O_NOFOLLOW
+	}
+	f, err := fsys.root.OpenFile(name, oflags)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// ReadDir implements [io/fs.ReadDirFS].
+func (fsys *RootFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	handle, err := fsys.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer handle.Close()
+
+	dirFile, err := handle.OpenFile(unix.O_RDONLY | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer dirFile.Close()
+
+	// getdents(2) (via os.File.ReadDir) on the already-resolved, already
+	// O_DIRECTORY-verified fd -- no further path resolution is involved.
+	entries, err := dirFile.ReadDir(-1)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile implements [io/fs.ReadFileFS].
+func (fsys *RootFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements [io/fs.StatFS].
+func (fsys *RootFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	handle, err := fsys.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer handle.Close()
+
+	f, err := handle.OpenFile(unix.O_PATH)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// Sub implements [io/fs.SubFS], returning a new [RootFS] reparented to dir
+// (resolved the same way Open would resolve it). The returned FS's root is
+// an independent Handle -- closing the original Root does not affect it.
+func (fsys *RootFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+
+	handle, err := fsys.resolve(dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: err}
+	}
+	defer handle.Close()
+
+	f, err := handle.OpenFile(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: err}
+	}
+	defer f.Close()
+
+	subRoot, err := RootFromFile(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: err}
+	}
+	return &RootFS{root: subRoot, follow: fsys.follow}, nil
+}
@@ -0,0 +1,163 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// MkdirAll creates a directory named unsafePath, along with any necessary
+// parents, within the Root's directory tree, and returns a Handle to the
+// final directory component. Existing directories are left untouched
+// (mirroring os.MkdirAll); MkdirAll never chmods a pre-existing component to
+// force it to match mode.
+//
+// The algorithm is modeled on filepath-securejoin's MkdirAll: first the
+// longest already-existing prefix of the path is located using the Root's
+// safe resolver (so we don't redundantly re-walk components that are
+// already there), and then the remaining components are created one at a
+// time with mkdirat(2) immediately followed by a hardened openat(2) of the
+// entry we just made -- using openat2(RESOLVE_BENEATH|RESOLVE_NO_SYMLINKS|
+// RESOLVE_NO_XDEV) where available, or a plain O_NOFOLLOW openat(2) plus an
+// fstat-based inode check otherwise. This closes the race where an attacker
+// substitutes a symlink (or a new mountpoint) for the component between our
+// mkdirat and our open of it.
+func (r *Root) MkdirAll(unsafePath string, mode os.FileMode) (*Handle, error) {
+	clean := path.Clean("/" + unsafePath)
+	var components []string
+	for _, component := range strings.Split(strings.TrimPrefix(clean, "/"), "/") {
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			return nil, fmt.Errorf("mkdir all %q: %q component not allowed", unsafePath, "..")
+		}
+		components = append(components, component)
+	}
+
+	handle, prefixLen, err := resolveExistingPrefix(r, components)
+	if err != nil {
+		return nil, fmt.Errorf("mkdir all %q: %w", unsafePath, err)
+	}
+	defer handle.Close()
+
+	dirFile, err := handle.OpenFile(unix.O_PATH | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, fmt.Errorf("mkdir all %q: open existing prefix: %w", unsafePath, err)
+	}
+
+	for _, component := range components[prefixLen:] {
+		child, err := mkdirComponent(dirFile, component, mode)
+		dirFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("mkdir all %q: mkdir %q: %w", unsafePath, component, err)
+		}
+		dirFile = child
+	}
+
+	defer dirFile.Close()
+	return HandleFromRaw(dirFile)
+}
+
+// MkdirAllHandle is an alias of MkdirAll, provided to match the naming used
+// by the filepath-securejoin implementation this algorithm is modeled on.
+func (r *Root) MkdirAllHandle(unsafePath string, mode os.FileMode) (*Handle, error) {
+	return r.MkdirAll(unsafePath, mode)
+}
+
+// resolveExistingPrefix finds the longest prefix of components that already
+// exists under r, resolving each candidate prefix through r's safe
+// resolver. It returns a Handle to that prefix (the root itself if none of
+// components exist yet) along with how many components it consumed.
+func resolveExistingPrefix(r *Root, components []string) (*Handle, int, error) {
+	handle, err := r.Resolve(".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("resolve root: %w", err)
+	}
+
+	prefixLen := 0
+	for i := range components {
+		built := "/" + path.Join(components[:i+1]...)
+		next, err := r.Resolve(built)
+		if err != nil {
+			break
+		}
+		handle.Close()
+		handle = next
+		prefixLen = i + 1
+	}
+	return handle, prefixLen, nil
+}
+
+// mkdirComponent creates name as a subdirectory of dirFile (an O_DIRECTORY
+// fd) with the given mode, and returns a hardened O_PATH|O_DIRECTORY handle
+// to the directory it just created (or that already existed).
+func mkdirComponent(dirFile *os.File, name string, mode os.FileMode) (*os.File, error) {
+	// mode.Perm() alone would silently drop setuid/setgid/sticky, since those
+	// live in fs.FileMode's high bits rather than the low 0o777 permission
+	// bits mkdirat(2) expects; toUnixMode does the full translation (and
+	// ORs in S_IFDIR, which mkdirat ignores, so that's harmless here).
+	sysMode, err := toUnixMode(mode | os.ModeDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Mkdirat(int(dirFile.Fd()), name, sysMode&0o7777); err != nil && !errors.Is(err, unix.EEXIST) {
+		return nil, err
+	}
+
+	const openFlags = unix.O_PATH | unix.O_DIRECTORY | unix.O_NOFOLLOW
+	childFd, err := unix.Openat2(int(dirFile.Fd()), name, &unix.OpenHow{
+		Flags:   openFlags,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_XDEV,
+	})
+	if errors.Is(err, unix.ENOSYS) {
+		childFd, err = unix.Openat(int(dirFile.Fd()), name, openFlags, 0)
+		if err == nil {
+			if verifyErr := verifyNotSubstituted(dirFile, name, childFd); verifyErr != nil {
+				unix.Close(childFd)
+				return nil, verifyErr
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(childFd), path.Join(dirFile.Name(), name)), nil
+}
+
+// verifyNotSubstituted guards the openat2-unavailable fallback path: it
+// confirms that the inode we just opened as childFd is the same one an
+// AT_SYMLINK_NOFOLLOW lstat of name (relative to dirFile) reports, so that a
+// symlink or mountpoint raced into place between our mkdirat and our openat
+// is detected rather than silently followed.
+func verifyNotSubstituted(dirFile *os.File, name string, childFd int) error {
+	var lstat, fstat unix.Stat_t
+	if err := unix.Fstatat(int(dirFile.Fd()), name, &lstat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("verify %q: %w", name, err)
+	}
+	if err := unix.Fstat(childFd, &fstat); err != nil {
+		return fmt.Errorf("verify %q: %w", name, err)
+	}
+	if lstat.Dev != fstat.Dev || lstat.Ino != fstat.Ino {
+		return fmt.Errorf("verify %q: component was substituted after mkdir (possible symlink race)", name)
+	}
+	return nil
+}
@@ -14,13 +14,32 @@
 package pathrs
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/cyphar/libpathrs/go-pathrs/internal/libpathrs"
 )
 
+// ErrUnsafeProcfs is returned (wrapped) when a [ProcfsHandle] fails the
+// authenticity checks performed by [ProcfsHandle.Verify] -- that is, the
+// underlying fd does not actually point at a genuine procfs root (or, for
+// [UnmaskedProcRoot] handles, the fd is not actually the real root of a
+// procfs mount). Callers can use errors.Is(err, ErrUnsafeProcfs) to
+// distinguish this from a transient I/O failure.
+var ErrUnsafeProcfs = errors.New("fd does not appear to be a genuine procfs handle")
+
+// procSuperMagic is PROC_SUPER_MAGIC, the f_type reported by statfs(2) for
+// any procfs mount.
+const procSuperMagic = 0x9fa0
+
+// procRootIno is PROC_ROOT_INO, the inode number the kernel guarantees for
+// the root directory of a procfs mount.
+const procRootIno = 1
+
 // ProcBase is used with [ProcReadlink] and related functions to indicate what
 // /proc subpath path operations should be done relative to.
 type ProcBase struct {
@@ -134,7 +153,74 @@ func OpenProcRoot(opts ...OpenProcRootOption) (*ProcfsHandle, error) {
 		procFile = os.NewFile(fd, "/proc")
 	}
 	// TODO: Check that fd == PATHRS_PROC_DEFAULT_ROOTFD in the <0 case?
-	return &ProcfsHandle{inner: procFile}, nil
+	proc := &ProcfsHandle{inner: procFile}
+
+	unmasked := *how.Flags()&libpathrs.ProcfsNewUnmasked != 0
+	if err := proc.verify(unmasked); err != nil {
+		_ = proc.Close()
+		return nil, err
+	}
+	return proc, nil
+}
+
+// Verify independently checks that proc's underlying fd really does point
+// at a procfs root, rather than trusting whatever fd libpathrs handed back.
+// It is called automatically by [OpenProcRoot], so most callers never need
+// to call it themselves -- it is exposed for programs (such as the sysctl
+// example) that want to re-check a long-lived handle before using it to
+// read security-sensitive data.
+//
+// A failed check is reported by wrapping [ErrUnsafeProcfs].
+func (proc *ProcfsHandle) Verify() error {
+	// A negative fd means we're using the libpathrs-internal cached handle,
+	// which libpathrs itself is responsible for validating.
+	if proc.inner == nil {
+		return nil
+	}
+	return proc.verify(false)
+}
+
+// verify implements the fstatfs/fstat checks described by [ProcfsHandle.Verify].
+// unmasked additionally requests the "parent is not the same inode" check
+// that only applies to handles opened with [UnmaskedProcRoot].
+func (proc *ProcfsHandle) verify(unmasked bool) error {
+	if proc.inner == nil {
+		return nil
+	}
+	fd := int(proc.inner.Fd())
+
+	var statfs unix.Statfs_t
+	if err := unix.Fstatfs(fd, &statfs); err != nil {
+		return fmt.Errorf("statfs procfs handle: %w", err)
+	}
+	if statfs.Type != procSuperMagic {
+		return fmt.Errorf("%w: f_type %#x is not PROC_SUPER_MAGIC", ErrUnsafeProcfs, statfs.Type)
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("stat procfs handle: %w", err)
+	}
+	if stat.Ino != procRootIno {
+		return fmt.Errorf("%w: st_ino %d is not PROC_ROOT_INO", ErrUnsafeProcfs, stat.Ino)
+	}
+
+	if unmasked {
+		parentFd, err := unix.Openat(fd, "..", unix.O_PATH|unix.O_DIRECTORY, 0)
+		if err != nil {
+			return fmt.Errorf("open parent of unmasked procfs handle: %w", err)
+		}
+		defer unix.Close(parentFd)
+
+		var parentStat unix.Stat_t
+		if err := unix.Fstat(parentFd, &parentStat); err != nil {
+			return fmt.Errorf("stat parent of unmasked procfs handle: %w", err)
+		}
+		if parentStat.Dev == stat.Dev && parentStat.Ino == stat.Ino {
+			return fmt.Errorf("%w: unmasked handle has no distinct parent (bind-mount over a procfs subdirectory?)", ErrUnsafeProcfs)
+		}
+	}
+	return nil
 }
 
 func (proc *ProcfsHandle) fd() int {
@@ -145,8 +231,9 @@ func (proc *ProcfsHandle) fd() int {
 }
 
 // TODO: Should we expose open?
-func (proc *ProcfsHandle) open(base ProcBase, path string, flags int) (_ *os.File, Closer ProcHandleCloser, Err error) {
+func (proc *ProcfsHandle) open(base ProcBase, path string, flags int, opts ...ResolverOption) (_ *os.File, Closer ProcHandleCloser, Err error) {
 	namePrefix := base.namePrefix()
+	resolver := collectResolverFlags(opts)
 
 	var closer ProcHandleCloser
 	if base == ProcBaseThreadSelf {
@@ -164,6 +251,16 @@ func (proc *ProcfsHandle) open(base ProcBase, path string, flags int) (_ *os.Fil
 	if err != nil {
 		return nil, nil, err
 	}
+	if resolver != 0 {
+		// libpathrs/the kernel had no chance to enforce these flags during
+		// the openat above, and [applyResolverFlags] cannot emulate them
+		// after the fact, so any requested flag fails the open with
+		// [ErrResolverUnsupported].
+		if err := applyResolverFlags(proc.fd(), int(fd), resolver); err != nil {
+			_ = unix.Close(int(fd))
+			return nil, closer, fmt.Errorf("open %s%s: %w", namePrefix, path, err)
+		}
+	}
 	return os.NewFile(fd, namePrefix+path), closer, nil
 }
 
@@ -173,8 +270,12 @@ func (proc *ProcfsHandle) open(base ProcBase, path string, flags int) (_ *os.Fil
 // (such as /proc/cpuinfo) or information about other processes (such as
 // /proc/1). Accessing your own process information should be done using
 // [ProcfsHandle.OpenSelf] or [ProcfsHandle.OpenThreadSelf].
-func (proc *ProcfsHandle) OpenRoot(path string, flags int) (*os.File, error) {
-	file, closer, err := proc.open(ProcBaseRoot, path, flags)
+//
+// opts takes [ResolverOption]s, but procfs opens cannot enforce
+// [ResolverFlags]: if opts requests any flag, the open fails with
+// [ErrResolverUnsupported].
+func (proc *ProcfsHandle) OpenRoot(path string, flags int, opts ...ResolverOption) (*os.File, error) {
+	file, closer, err := proc.open(ProcBaseRoot, path, flags, opts...)
 	if closer != nil {
 		// should not happen
 		panic("non-zero closer returned from procOpen(ProcBaseRoot)")
@@ -201,8 +302,8 @@ func (proc *ProcfsHandle) OpenRoot(path string, flags int) (*os.File, error) {
 // theoretically has slightly less overhead.
 //
 // [runtime.LockOSThread]: https://pkg.go.dev/runtime#LockOSThread
-func (proc *ProcfsHandle) OpenSelf(path string, flags int) (*os.File, error) {
-	file, closer, err := proc.open(ProcBaseSelf, path, flags)
+func (proc *ProcfsHandle) OpenSelf(path string, flags int, opts ...ResolverOption) (*os.File, error) {
+	file, closer, err := proc.open(ProcBaseSelf, path, flags, opts...)
 	if closer != nil {
 		// should not happen
 		panic("non-zero closer returned from procOpen(ProcBaseSelf)")
@@ -219,8 +320,8 @@ func (proc *ProcfsHandle) OpenSelf(path string, flags int) (*os.File, error) {
 // Be aware that due to PID recycling, using this is generally not safe except
 // in certain circumstances. See the documentation of [ProcBasePid] for more
 // details.
-func (proc *ProcfsHandle) OpenPid(pid int, path string, flags int) (*os.File, error) {
-	file, closer, err := proc.open(ProcBasePid(pid), path, flags)
+func (proc *ProcfsHandle) OpenPid(pid int, path string, flags int, opts ...ResolverOption) (*os.File, error) {
+	file, closer, err := proc.open(ProcBasePid(pid), path, flags, opts...)
 	if closer != nil {
 		// should not happen
 		panic("non-zero closer returned from procOpen(ProcPidOpen)")
@@ -250,8 +351,8 @@ func (proc *ProcfsHandle) OpenPid(pid int, path string, flags int) (*os.File, er
 // [runtime.LockOSThread]: https://pkg.go.dev/runtime#LockOSThread
 // [os.File]: https://pkg.go.dev/os#File
 // [os.File.Close]: https://pkg.go.dev/os#File.Close
-func (proc *ProcfsHandle) OpenThreadSelf(path string, flags int) (*os.File, ProcHandleCloser, error) {
-	return proc.open(ProcBaseThreadSelf, path, flags)
+func (proc *ProcfsHandle) OpenThreadSelf(path string, flags int, opts ...ResolverOption) (*os.File, ProcHandleCloser, error) {
+	return proc.open(ProcBaseThreadSelf, path, flags, opts...)
 }
 
 // Readlink safely reads the contents of a symlink from the given procfs base.
@@ -0,0 +1,252 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ReadDir lists the entries of the directory at path (relative to base),
+// without ever re-resolving path between listing the directory and
+// stat-ing each entry: the directory is opened once via the same
+// O_DIRECTORY|O_NOFOLLOW helper used by Open*, and every returned
+// DirEntry's Info is fetched with fstatat(2) against that held directory
+// fd while it is still open.
+func (proc *ProcfsHandle) ReadDir(base ProcBase, path string) ([]fs.DirEntry, error) {
+	f, closer, err := proc.open(base, path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	defer f.Close()
+
+	names, err := readDirNames(int(f.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("readdir %s%s: %w", base.namePrefix(), path, err)
+	}
+	sort.Strings(names)
+
+	dirfd := int(f.Fd())
+	entries := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		// Snapshot the stat result now, while dirfd is still open, so that
+		// DirEntry.Info() keeps working after ReadDir returns (and f is
+		// closed) without ever touching /proc again.
+		var st unix.Stat_t
+		statErr := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+		entries[i] = newProcDirEntry(name, func() (unix.Stat_t, error) { return st, statErr })
+	}
+	return entries, nil
+}
+
+// ProcDirIter is a streaming counterpart to the slice returned by ReadDir:
+// it reads directory entries off a held directory fd one 8 KiB getdents(2)
+// buffer at a time, handing them out one entry at a time, instead of
+// draining the whole directory upfront. See
+// [ProcfsHandle.ReadDirIter].
+type ProcDirIter struct {
+	dirFile *os.File
+
+	// buf/off hold one getdents(2) buffer's worth of raw entries; Next
+	// parses exactly one entry out of it at a time (via ParseDirent's max
+	// parameter) before going back to the kernel, rather than draining the
+	// whole directory upfront the way ReadDir does.
+	buf []byte
+	off int
+	eof bool
+	cur string
+}
+
+// Next advances the iterator to the next entry, returning false once every
+// entry has been consumed. Next has no error return and the iterator keeps
+// no error: an I/O error from getdents(2) (or a malformed buffer) also makes
+// Next return false, and is not reported anywhere.
+func (it *ProcDirIter) Next() bool {
+	for {
+		if it.off < len(it.buf) {
+			consumed, count, names := unix.ParseDirent(it.buf[it.off:], 1, nil)
+			if consumed <= 0 {
+				// Malformed/truncated buffer; stop rather than spin.
+				it.eof = true
+				return false
+			}
+			it.off += consumed
+			if count > 0 {
+				it.cur = names[0]
+				return true
+			}
+			// ParseDirent skipped "." / ".." or a deleted (ino == 0) entry
+			// without producing a name; keep parsing this same buffer.
+			continue
+		}
+		if it.eof {
+			return false
+		}
+		if it.buf == nil {
+			it.buf = make([]byte, 8192)
+		}
+		n, err := unix.ReadDirent(int(it.dirFile.Fd()), it.buf[:cap(it.buf)])
+		if err != nil || n <= 0 {
+			it.eof = true
+			return false
+		}
+		it.buf = it.buf[:n]
+		it.off = 0
+	}
+}
+
+// Entry returns the entry Next just advanced to. It is only valid to call
+// this after a call to Next that returned true.
+func (it *ProcDirIter) Entry() fs.DirEntry {
+	name := it.cur
+	dirfd := int(it.dirFile.Fd())
+	return newProcDirEntry(name, func() (unix.Stat_t, error) {
+		var st unix.Stat_t
+		err := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+		return st, err
+	})
+}
+
+// Close releases the directory handle backing the iterator. It does not
+// release the OS thread lock held by a [ProcBaseThreadSelf] iterator --
+// call the ProcHandleCloser returned alongside it for that.
+func (it *ProcDirIter) Close() error {
+	return it.dirFile.Close()
+}
+
+// ReadDirIter is the streaming variant of ReadDir: the directory handle (and,
+// for [ProcBaseThreadSelf], the OS thread lock) stays live until the caller
+// calls Close on the returned [ProcDirIter] and invokes the returned
+// [ProcHandleCloser], so iteration never needs to re-resolve path through
+// /proc. Unlike ReadDir, entries are fetched from the kernel one getdents(2)
+// buffer (8 KiB) at a time as Next needs them, instead of paying for a full
+// directory listing upfront -- the tradeoff is that entries come back in
+// whatever order the kernel (not this package) returns them in, rather than
+// ReadDir's sorted order. This is the natural building block for auditing
+// /proc/self/fd, walking /proc/$pid/task, and similar.
+func (proc *ProcfsHandle) ReadDirIter(base ProcBase, path string) (*ProcDirIter, ProcHandleCloser, error) {
+	f, closer, err := proc.open(base, path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ProcDirIter{dirFile: f}, closer, nil
+}
+
+// readDirNames drains every directory entry from fd via getdents(2)
+// (unix.ReadDirent/unix.ParseDirent already filter out "." and "..").
+func readDirNames(fd int) ([]string, error) {
+	var names []string
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.ReadDirent(fd, buf)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			break
+		}
+		_, _, names = unix.ParseDirent(buf[:n], -1, names)
+	}
+	return names, nil
+}
+
+// procDirEntry implements fs.DirEntry on top of a deferred fstatat(2) call,
+// so both the eager (ReadDir) and streaming (ReadDirIter) cases can share
+// the same type: for ReadDir, stat is a closure over an already-fetched
+// result; for ReadDirIter, it fstatats the held dirfd lazily.
+type procDirEntry struct {
+	name string
+	stat func() (unix.Stat_t, error)
+}
+
+func newProcDirEntry(name string, stat func() (unix.Stat_t, error)) *procDirEntry {
+	return &procDirEntry{name: name, stat: stat}
+}
+
+func (e *procDirEntry) Name() string { return e.name }
+
+func (e *procDirEntry) Type() fs.FileMode {
+	st, err := e.stat()
+	if err != nil {
+		return 0
+	}
+	return fileModeFromStat(st.Mode) & fs.ModeType
+}
+
+func (e *procDirEntry) IsDir() bool {
+	return e.Type()&fs.ModeDir != 0
+}
+
+func (e *procDirEntry) Info() (fs.FileInfo, error) {
+	st, err := e.stat()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: e.name, Err: err}
+	}
+	return &procFileInfo{name: e.name, stat: st}, nil
+}
+
+// procFileInfo implements fs.FileInfo from a unix.Stat_t snapshot.
+type procFileInfo struct {
+	name string
+	stat unix.Stat_t
+}
+
+func (fi *procFileInfo) Name() string       { return fi.name }
+func (fi *procFileInfo) Size() int64        { return fi.stat.Size }
+func (fi *procFileInfo) Mode() fs.FileMode  { return fileModeFromStat(fi.stat.Mode) }
+func (fi *procFileInfo) ModTime() time.Time { return time.Unix(fi.stat.Mtim.Sec, fi.stat.Mtim.Nsec) }
+func (fi *procFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *procFileInfo) Sys() any           { return &fi.stat }
+
+// fileModeFromStat converts a raw stat(2) st_mode into an fs.FileMode, the
+// inverse of toUnixMode. Unlike the raw mode bits, fs.FileMode keeps the
+// setuid/setgid/sticky bits separate from the 0o777 permission bits (as the
+// high ModeSetuid/ModeSetgid/ModeSticky bits), so those three have to be
+// translated explicitly rather than folded straight through.
+func fileModeFromStat(mode uint32) fs.FileMode {
+	perm := fs.FileMode(mode & 0o777)
+	if mode&unix.S_ISUID != 0 {
+		perm |= fs.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		perm |= fs.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		perm |= fs.ModeSticky
+	}
+	switch mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return perm | fs.ModeDir
+	case unix.S_IFLNK:
+		return perm | fs.ModeSymlink
+	case unix.S_IFCHR:
+		return perm | fs.ModeDevice | fs.ModeCharDevice
+	case unix.S_IFBLK:
+		return perm | fs.ModeDevice
+	case unix.S_IFIFO:
+		return perm | fs.ModeNamedPipe
+	case unix.S_IFSOCK:
+		return perm | fs.ModeSocket
+	default:
+		return perm
+	}
+}
@@ -0,0 +1,168 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ResolverFlags is a bitmask of openat2(2) RESOLVE_* restrictions that can
+// be requested of the safe resolver, in addition to the symlink/TOCTOU
+// protection Root and Handle already provide unconditionally.
+type ResolverFlags uint64
+
+const (
+	// ResolveNoXDev refuses to cross filesystem (mount) boundaries during
+	// resolution.
+	ResolveNoXDev ResolverFlags = ResolverFlags(unix.RESOLVE_NO_XDEV)
+	// ResolveNoMagiclinks refuses to resolve magic links (e.g.
+	// /proc/$pid/fd/$n-style symlinks that the kernel resolves specially).
+	ResolveNoMagiclinks ResolverFlags = ResolverFlags(unix.RESOLVE_NO_MAGICLINKS)
+	// ResolveNoSymlinks refuses to resolve any symlink at all.
+	ResolveNoSymlinks ResolverFlags = ResolverFlags(unix.RESOLVE_NO_SYMLINKS)
+	// ResolveBeneath refuses resolution that would climb above the starting
+	// point via "..".
+	ResolveBeneath ResolverFlags = ResolverFlags(unix.RESOLVE_BENEATH)
+	// ResolveInRoot treats the starting point as a chroot-like root for the
+	// duration of resolution.
+	ResolveInRoot ResolverFlags = ResolverFlags(unix.RESOLVE_IN_ROOT)
+	// ResolveCached fails instead of blocking if resolution would require
+	// revalidating a cached entry (e.g. a network filesystem).
+	ResolveCached ResolverFlags = ResolverFlags(unix.RESOLVE_CACHED)
+)
+
+// ErrResolverUnsupported is returned (wrapped) when a requested
+// ResolverFlags bit cannot be honoured -- either libpathrs was built
+// against a kernel without openat2(2) support at all, or the specific flag
+// has no safe emulation in the O_PATH-walk fallback. Callers can use
+// errors.Is(err, ErrResolverUnsupported) to degrade gracefully (e.g. by
+// retrying without the unsupported flag) instead of treating it as a fatal
+// error.
+var ErrResolverUnsupported = errors.New("resolver flag not supported on this kernel/build")
+
+// ResolverOption configures the [ResolverFlags] passed to [Root.ResolveWithFlags]
+// and the procfs Open* methods.
+type ResolverOption func(*ResolverFlags)
+
+// WithFlags ORs flags directly into the resolver configuration. It exists
+// alongside the With* constructors for callers (such as the pathrs-cmd CLI)
+// that already have a parsed ResolverFlags bitmask on hand.
+func WithFlags(flags ResolverFlags) ResolverOption {
+	return func(f *ResolverFlags) { *f |= flags }
+}
+
+// WithNoXDev requests [ResolveNoXDev].
+func WithNoXDev() ResolverOption { return WithFlags(ResolveNoXDev) }
+
+// WithNoMagiclinks requests [ResolveNoMagiclinks].
+func WithNoMagiclinks() ResolverOption { return WithFlags(ResolveNoMagiclinks) }
+
+// WithNoSymlinks requests [ResolveNoSymlinks].
+func WithNoSymlinks() ResolverOption { return WithFlags(ResolveNoSymlinks) }
+
+// WithBeneath requests [ResolveBeneath].
+func WithBeneath() ResolverOption { return WithFlags(ResolveBeneath) }
+
+// WithInRoot requests [ResolveInRoot].
+func WithInRoot() ResolverOption { return WithFlags(ResolveInRoot) }
+
+// WithCached requests [ResolveCached].
+func WithCached() ResolverOption { return WithFlags(ResolveCached) }
+
+// collectResolverFlags applies every opts to a zero ResolverFlags value.
+func collectResolverFlags(opts []ResolverOption) ResolverFlags {
+	var flags ResolverFlags
+	for _, opt := range opts {
+		opt(&flags)
+	}
+	return flags
+}
+
+// applyResolverFlags is used by callers (such as the procfs Open* family in
+// procfs_linux.go) whose underlying open step has no way to pass RESOLVE_*
+// flags to the kernel walk itself, and so cannot be fixed by switching to
+// [unix.Openat2] the way [Root.ResolveWithFlags] was. There is no safe way
+// to emulate these flags after the fact: a comparison made only against the
+// already-opened (referenceFd, fd) pair (e.g. "is the final fd on a
+// different filesystem than the root") cannot detect a restriction that was
+// only violated mid-path, so rather than silently approve something that
+// was never actually enforced during the walk, this always fails closed
+// with ErrResolverUnsupported whenever any flag was requested.
+func applyResolverFlags(referenceFd, fd int, flags ResolverFlags) error {
+	if flags == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %#x", ErrResolverUnsupported, flags)
+}
+
+// ResolveWithFlags is equivalent to Resolve (or ResolveNoFollow, if follow is
+// false), but additionally enforces flags during resolution. Unlike callers
+// that can't reach this method (which reject any flag, see
+// [applyResolverFlags]), flags are passed straight to the kernel via
+// openat2(2)'s Resolve bitmask, so they are enforced for the whole walk --
+// including mid-path mount crossings for [ResolveNoXDev]. RESOLVE_IN_ROOT is ORed in to keep this
+// walk confined to the Root, matching the containment Resolve/ResolveNoFollow
+// already provide unconditionally -- except when the caller requested
+// [WithBeneath], since the kernel rejects RESOLVE_BENEATH|RESOLVE_IN_ROOT
+// with EINVAL outright (they're mutually exclusive: BENEATH already refuses
+// to climb above rootFile, which is the Root's own directory fd, so it gives
+// the same containment here without IN_ROOT's help).
+//
+// If the running kernel doesn't support openat2(2) at all, or doesn't
+// recognise one of the requested flags, this fails with
+// [ErrResolverUnsupported] rather than silently resolving the path with a
+// weaker guarantee than what was asked for.
+func (r *Root) ResolveWithFlags(unsafePath string, follow bool, opts ...ResolverOption) (*Handle, error) {
+	flags := collectResolverFlags(opts)
+	if flags == 0 {
+		if follow {
+			return r.Resolve(unsafePath)
+		}
+		return r.ResolveNoFollow(unsafePath)
+	}
+
+	rootFile, err := r.Open(".")
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q with flags: open root: %w", unsafePath, err)
+	}
+	defer rootFile.Close()
+
+	oflags := uint64(unix.O_PATH | unix.O_CLOEXEC)
+	if !follow {
+		oflags |= unix.O_NOFOLLOW
+	}
+	resolve := uint64(flags)
+	if flags&ResolveBeneath == 0 {
+		resolve |= unix.RESOLVE_IN_ROOT
+	}
+	how := unix.OpenHow{
+		Flags:   oflags,
+		Resolve: resolve,
+	}
+
+	fd, err := unix.Openat2(int(rootFile.Fd()), unsafePath, &how)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+			return nil, fmt.Errorf("resolve %q with flags %#x: %w", unsafePath, flags, errors.Join(err, ErrResolverUnsupported))
+		}
+		return nil, fmt.Errorf("resolve %q with flags: %w", unsafePath, err)
+	}
+	f := os.NewFile(uintptr(fd), unsafePath)
+	defer f.Close()
+	return HandleFromRaw(f)
+}
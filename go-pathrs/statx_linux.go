@@ -0,0 +1,155 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Statx resolves unsafePath through the Root's safe resolver into an
+// O_PATH fd and then issues statx(2) against that fd with AT_EMPTY_PATH, so
+// there is no second path lookup between resolution and stat-ing that could
+// race with a concurrent rename/replace. flags is interpreted the same way
+// as fstatat(2)'s flags argument (AT_SYMLINK_NOFOLLOW is honoured both for
+// the resolve step and for the statx call itself); mask is the requested
+// STATX_* field bitmask.
+//
+// On a kernel that predates statx(2) entirely (ENOSYS), this falls back to
+// fstatat(AT_EMPTY_PATH); no fstatfs(2) call is made and no filesystem ID is
+// reported. A kernel that has statx(2) but lacks a requested mask bit does
+// not trigger the fallback: statx(2) simply leaves that bit out of Mask. The
+// returned Statx_t.Mask always reflects which fields were actually
+// populated, which may be a subset of mask in the fallback case (STATX_BTIME
+// and STATX_MNT_ID in particular have no fstatat-based equivalent).
+func (r *Root) Statx(unsafePath string, mask uint32, flags int) (unix.Statx_t, error) {
+	noFollow := flags&unix.AT_SYMLINK_NOFOLLOW != 0
+
+	var (
+		handle *Handle
+		err    error
+	)
+	if noFollow {
+		handle, err = r.ResolveNoFollow(unsafePath)
+	} else {
+		handle, err = r.Resolve(unsafePath)
+	}
+	if err != nil {
+		return unix.Statx_t{}, fmt.Errorf("statx %q: %w", unsafePath, err)
+	}
+	defer handle.Close()
+
+	oflags := unix.O_PATH
+	if noFollow {
+		oflags |= unix.O_NOFOLLOW
+	}
+	f, err := handle.OpenFile(oflags)
+	if err != nil {
+		return unix.Statx_t{}, fmt.Errorf("statx %q: %w", unsafePath, err)
+	}
+	defer f.Close()
+
+	stx, err := statxFd(int(f.Fd()), mask, flags)
+	if err != nil {
+		return unix.Statx_t{}, fmt.Errorf("statx %q: %w", unsafePath, err)
+	}
+	return stx, nil
+}
+
+// Statx is the procfs equivalent of [Root.Statx]: it resolves path (relative
+// to base) through the same safe Open* helper used elsewhere in this
+// package, and then statxes the resulting O_PATH fd with AT_EMPTY_PATH.
+func (proc *ProcfsHandle) Statx(base ProcBase, path string, mask uint32, flags int) (unix.Statx_t, error) {
+	oflags := unix.O_PATH
+	if flags&unix.AT_SYMLINK_NOFOLLOW != 0 {
+		oflags |= unix.O_NOFOLLOW
+	}
+
+	f, closer, err := proc.open(base, path, oflags)
+	if closer != nil {
+		defer closer()
+	}
+	if err != nil {
+		return unix.Statx_t{}, fmt.Errorf("statx %s%s: %w", base.namePrefix(), path, err)
+	}
+	defer f.Close()
+
+	stx, err := statxFd(int(f.Fd()), mask, flags)
+	if err != nil {
+		return unix.Statx_t{}, fmt.Errorf("statx %s%s: %w", base.namePrefix(), path, err)
+	}
+	return stx, nil
+}
+
+// statxFd issues statx(fd, "", flags|AT_EMPTY_PATH, mask, ...), falling back
+// to fstatat when statx(2) itself isn't implemented by the running kernel.
+func statxFd(fd int, mask uint32, flags int) (unix.Statx_t, error) {
+	var stx unix.Statx_t
+	err := unix.Statx(fd, "", flags|unix.AT_EMPTY_PATH, int(mask), &stx)
+	if errors.Is(err, unix.ENOSYS) {
+		return statxFallbackFd(fd, mask, flags)
+	}
+	if err != nil {
+		return unix.Statx_t{}, err
+	}
+	return stx, nil
+}
+
+// statxBasicMask is the set of STATX_* fields statxFallbackFd can actually
+// populate from fstatat. Notably absent: STATX_BTIME (no fstatat
+// equivalent) and STATX_MNT_ID/STATX_DIOALIGN (require statx(2) itself).
+const statxBasicMask = unix.STATX_TYPE | unix.STATX_MODE | unix.STATX_NLINK |
+	unix.STATX_UID | unix.STATX_GID | unix.STATX_ATIME | unix.STATX_MTIME |
+	unix.STATX_CTIME | unix.STATX_INO | unix.STATX_SIZE | unix.STATX_BLOCKS
+
+// statxFallbackFd emulates a statx(2) call using fstatat(2) alone (for the
+// basic fields); it does not call fstatfs(2), and nothing in the result
+// stands in for STATX_MNT_ID. The returned
+// Mask only has bits set for fields this fallback could actually populate,
+// so callers can detect a degraded result instead of silently trusting
+// zeroed fields.
+func statxFallbackFd(fd int, mask uint32, flags int) (unix.Statx_t, error) {
+	var st unix.Stat_t
+	statFlags := unix.AT_EMPTY_PATH
+	if flags&unix.AT_SYMLINK_NOFOLLOW != 0 {
+		statFlags |= unix.AT_SYMLINK_NOFOLLOW
+	}
+	if err := unix.Fstatat(fd, "", &st, statFlags); err != nil {
+		return unix.Statx_t{}, fmt.Errorf("fstatat fallback: %w", err)
+	}
+
+	var stx unix.Statx_t
+	stx.Mask = statxBasicMask & mask
+	stx.Blksize = uint32(st.Blksize)
+	stx.Nlink = uint32(st.Nlink)
+	stx.Uid = st.Uid
+	stx.Gid = st.Gid
+	stx.Mode = uint16(st.Mode)
+	stx.Ino = st.Ino
+	stx.Size = uint64(st.Size)
+	stx.Blocks = uint64(st.Blocks)
+	stx.Atime = unix.StatxTimestamp{Sec: st.Atim.Sec, Nsec: uint32(st.Atim.Nsec)}
+	stx.Mtime = unix.StatxTimestamp{Sec: st.Mtim.Sec, Nsec: uint32(st.Mtim.Nsec)}
+	stx.Ctime = unix.StatxTimestamp{Sec: st.Ctim.Sec, Nsec: uint32(st.Ctim.Nsec)}
+	stx.Rdev_major, stx.Rdev_minor = unix.Major(st.Rdev), unix.Minor(st.Rdev)
+	stx.Dev_major, stx.Dev_minor = unix.Major(st.Dev), unix.Minor(st.Dev)
+
+	// STATX_BTIME and STATX_MNT_ID are deliberately left unset in stx.Mask:
+	// there is no fstatat-based way to populate them, and claiming
+	// otherwise would let a NO_XDEV-style caller (see ResolverFlags) trust
+	// a mount ID comparison that was never actually made.
+	return stx, nil
+}
@@ -0,0 +1,156 @@
+//go:build linux
+
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * libpathrs: safe path resolution on Linux
+ * Copyright (C) 2019-2025 Aleksa Sarai <cyphar@cyphar.com>
+ * Copyright (C) 2019-2025 SUSE LLC
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package pathrs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// WalkFunc is the callback invoked by [Root.Walk] for every entry found
+// during the traversal (including the subpath the walk was started at).
+// relpath is the entry's path relative to that subpath, and handle is an
+// already-resolved [Handle] for the entry -- it is only valid for the
+// duration of the callback, so call [Handle.Clone] if you need to keep it
+// around afterwards.
+//
+// Returning [fs.SkipDir] from the callback for a directory entry skips
+// descending into that directory (but the walk continues with its
+// siblings); returning it for a non-directory entry skips the rest of the
+// entries in the containing directory. Returning [fs.SkipAll] stops the
+// walk entirely. Neither ever surfaces as an error from [Root.Walk] itself
+// (matching [filepath.WalkDir]'s contract) -- both are swallowed once
+// they've done their job of stopping the relevant part of the traversal.
+// Any other non-nil error aborts the walk and is returned from [Root.Walk]
+// as-is.
+type WalkFunc func(relpath string, handle *Handle, d fs.DirEntry) error
+
+// Walk performs a safe recursive walk of subpath (and everything below it)
+// within the Root's directory tree, invoking fn for every entry found.
+//
+// Unlike walking a plain path string with filepath.WalkDir, Walk never
+// re-resolves anything from the Root's path string after the initial
+// Resolve of subpath -- every descent step uses openat(2) relative to the
+// already-opened parent directory's fd, so the walk as a whole is immune to
+// TOCTOU races where a path component is replaced (e.g. with a symlink)
+// between being observed and being opened.
+func (r *Root) Walk(subpath string, fn WalkFunc) error {
+	handle, err := r.Resolve(subpath)
+	if err != nil {
+		return fmt.Errorf("walk: resolve %q: %w", subpath, err)
+	}
+	defer handle.Close()
+
+	switch err := walk(subpath, "", handle, fn); {
+	case errors.Is(err, fs.SkipAll), errors.Is(err, fs.SkipDir):
+		// Both are only meaningful to the recursive descent itself (as a
+		// signal to stop early): fs.SkipAll means the whole walk is done,
+		// and fs.SkipDir reaching all the way up here just means the
+		// top-level entry itself was skipped, with no siblings left for any
+		// caller to continue with. Neither should ever be visible outside
+		// Walk, matching filepath.WalkDir's contract.
+		return nil
+	default:
+		return err
+	}
+}
+
+// walk implements the recursive descent for [Root.Walk]. displayPath is only
+// used to produce useful error messages; relpath is the path passed to fn.
+func walk(displayPath, relpath string, handle *Handle, fn WalkFunc) error {
+	pathFd, err := handle.OpenFile(unix.O_PATH | unix.O_NOFOLLOW)
+	if err != nil {
+		return fmt.Errorf("walk: open %q: %w", displayPath, err)
+	}
+	defer pathFd.Close()
+
+	info, err := pathFd.Stat()
+	if err != nil {
+		return fmt.Errorf("walk: stat %q: %w", displayPath, err)
+	}
+	d := fs.FileInfoToDirEntry(info)
+
+	switch err := fn(relpath, handle, d); {
+	case errors.Is(err, fs.SkipAll):
+		return err
+	case errors.Is(err, fs.SkipDir):
+		if info.IsDir() {
+			// Don't descend, but let the caller continue with our siblings.
+			return nil
+		}
+		// Signal our caller to stop iterating the rest of this directory.
+		return err
+	case err != nil:
+		return err
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	dirFile, err := handle.OpenFile(unix.O_RDONLY | unix.O_DIRECTORY)
+	if err != nil {
+		return fmt.Errorf("walk: open %q as directory: %w", displayPath, err)
+	}
+	defer dirFile.Close()
+
+	// os.File.ReadDir(-1) returns entries in directory order, so sort them by
+	// filename to get a deterministic traversal order.
+	entries, err := dirFile.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("walk: readdir %q: %w", displayPath, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		childDisplay := path.Join(displayPath, entry.Name())
+		childRel := path.Join(relpath, entry.Name())
+
+		childHandle, err := openatHandle(dirFile, entry.Name())
+		if err != nil {
+			return fmt.Errorf("walk: open %q: %w", childDisplay, err)
+		}
+
+		err = walk(childDisplay, childRel, childHandle, fn)
+		childHandle.Close()
+		if err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				break // stop iterating the rest of this directory's entries
+			}
+			return err // includes fs.SkipAll and genuine errors
+		}
+	}
+	return nil
+}
+
+// openatHandle opens name relative to dirFile (which must be an open
+// directory fd) and wraps the result as a [Handle], without ever consulting
+// a path string -- this is the "openat-style descent" that makes [Root.Walk]
+// safe against concurrent modification of the tree being walked.
+func openatHandle(dirFile *os.File, name string) (*Handle, error) {
+	childFd, err := unix.Openat(int(dirFile.Fd()), name, unix.O_PATH|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	childFile := os.NewFile(uintptr(childFd), path.Join(dirFile.Name(), name))
+	defer childFile.Close()
+
+	return HandleFromRaw(childFile)
+}